@@ -0,0 +1,77 @@
+// Package config loads kcmd's optional settings file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"kui/internal/kubectl"
+)
+
+// DefaultExecTimeout applies when neither the config file nor a flag sets one.
+// Transfers and commands such as tail -f are not bounded by it.
+const DefaultExecTimeout = 5 * time.Minute
+
+// Config mirrors config.yaml. Durations are written the way Go parses them,
+// e.g. "30s" or "5m"; an exec timeout of 0 disables it.
+type Config struct {
+	ExecTimeout *metav1.Duration `json:"execTimeout,omitempty"`
+
+	// DebugImage replaces busybox in the built-in debug profiles.
+	DebugImage string `json:"debugImage,omitempty"`
+	// DebugProfile is the profile used when none is given on the command
+	// line.
+	DebugProfile  string                          `json:"debugProfile,omitempty"`
+	DebugProfiles map[string]kubectl.DebugProfile `json:"debugProfiles,omitempty"`
+}
+
+// Path returns the config file location, $XDG_CONFIG_HOME/kcmd/config.yaml
+// or the platform equivalent.
+func Path() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "kcmd", "config.yaml"), nil
+}
+
+// Load reads the config file. A missing file is not an error and yields the
+// defaults.
+func Load() (*Config, error) {
+	cfg := &Config{}
+	path, err := Path()
+	if err != nil {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Timeout returns the configured exec timeout or DefaultExecTimeout.
+func (c *Config) Timeout() time.Duration {
+	if c.ExecTimeout == nil {
+		return DefaultExecTimeout
+	}
+	return c.ExecTimeout.Duration
+}
+
+// Profiles returns the built-in and configured debug profiles.
+func (c *Config) Profiles() ([]kubectl.DebugProfile, error) {
+	return kubectl.DebugProfiles(c.DebugImage, c.DebugProfiles)
+}
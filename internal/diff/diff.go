@@ -0,0 +1,218 @@
+// Package diff produces line-based unified diffs.
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Op is the kind of a diff line.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line is one line of an edit script.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Lines returns the shortest edit script turning a into b, using Myers'
+// O(ND) algorithm.
+func Lines(a, b []string) []Line {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+
+	for d := 0; d <= offset; d++ {
+		// Only diagonals -d..d can be reached from step d, so that is all
+		// backtracking needs.
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, d)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(a, b []string, trace [][]int, d int) []Line {
+	var script []Line
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			script = append(script, Line{Equal, a[x]})
+		}
+		if x == prevX {
+			y--
+			script = append(script, Line{Insert, b[y]})
+		} else {
+			x--
+			script = append(script, Line{Delete, a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		script = append(script, Line{Equal, a[x]})
+	}
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+	compact(script)
+	return script
+}
+
+// compact rearranges an edit script the way diff -u shows it, without
+// changing its meaning. A change that is separated from the change above it
+// only by equal lines with the same text is moved up next to it, and within
+// each run of changes the deletions come first.
+func compact(script []Line) {
+	for moved := true; moved; {
+		moved = false
+		for j := 1; j < len(script); j++ {
+			if script[j].Op == Equal || script[j-1].Op != Equal {
+				continue
+			}
+			k := j
+			for k > 0 && script[k-1].Op == Equal && script[k-1].Text == script[j].Text {
+				k--
+			}
+			if k == 0 || script[k-1].Op == Equal {
+				continue
+			}
+			line := script[j]
+			copy(script[k+1:j+1], script[k:j])
+			script[k] = line
+			moved = true
+		}
+	}
+	for i := 0; i < len(script); {
+		if script[i].Op == Equal {
+			i++
+			continue
+		}
+		j := i
+		for j < len(script) && script[j].Op != Equal {
+			j++
+		}
+		slices.SortStableFunc(script[i:j], func(x, y Line) int { return int(x.Op) - int(y.Op) })
+		i = j
+	}
+}
+
+// Unified returns the hunks of a unified diff from a to b with the given
+// lines of context, without the ---/+++ header. It is empty when a and b are
+// equal.
+func Unified(a, b []string, context int) []string {
+	script := Lines(a, b)
+	var out []string
+	for i := 0; i < len(script); {
+		if script[i].Op == Equal {
+			i++
+			continue
+		}
+		// Extend the hunk while changes are within 2*context of each other.
+		start := max(i-context, 0)
+		end := i
+		for end < len(script) {
+			if script[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(script) && script[run].Op == Equal {
+				run++
+			}
+			if run == len(script) || run-end > 2*context {
+				end = min(end+context, len(script))
+				break
+			}
+			end = run
+		}
+
+		aStart, bStart := lineNumbers(script[:start])
+		aLen, bLen := 0, 0
+		var body []string
+		for _, l := range script[start:end] {
+			switch l.Op {
+			case Equal:
+				aLen++
+				bLen++
+				body = append(body, " "+l.Text)
+			case Delete:
+				aLen++
+				body = append(body, "-"+l.Text)
+			case Insert:
+				bLen++
+				body = append(body, "+"+l.Text)
+			}
+		}
+		out = append(out, fmt.Sprintf("@@ -%s +%s @@", hunkRange(aStart, aLen), hunkRange(bStart, bLen)))
+		out = append(out, body...)
+		i = end
+	}
+	return out
+}
+
+func lineNumbers(script []Line) (int, int) {
+	a, b := 0, 0
+	for _, l := range script {
+		if l.Op != Insert {
+			a++
+		}
+		if l.Op != Delete {
+			b++
+		}
+	}
+	return a, b
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// SplitLines splits command output into lines, ignoring a final newline.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
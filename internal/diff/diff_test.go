@@ -0,0 +1,118 @@
+package diff
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want string
+	}{
+		{"empty", nil, nil, ""},
+		{"equal", []string{"a", "b"}, []string{"a", "b"}, " a  b"},
+		{"insert", nil, []string{"x"}, "+x"},
+		{"delete", []string{"x"}, nil, "-x"},
+		{"change", []string{"a", "b", "c"}, []string{"a", "x", "c"}, " a -b +x  c"},
+		{"change first of repeated", []string{"a", "a", "a"}, []string{"b", "a", "a"}, "-a +b  a  a"},
+		{"deletes before inserts", []string{"a", "b", "c"}, []string{"x", "y", "c"}, "-a -b +x +y  c"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, l := range Lines(tt.a, tt.b) {
+			got = append(got, string(" -+"[l.Op])+l.Text)
+		}
+		if s := strings.Join(got, " "); s != tt.want {
+			t.Errorf("%s: Lines = %q, want %q", tt.name, s, tt.want)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    []string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", 3, nil},
+		{"into empty", "", "x\n", 3, []string{"@@ -0,0 +1 @@", "+x"}},
+		{
+			"one change", "1\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\nx\n5\n6\n7\n", 3,
+			[]string{"@@ -1,7 +1,7 @@", " 1", " 2", " 3", "-4", "+x", " 5", " 6", " 7"},
+		},
+		{
+			"two hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "0\n1\n2\n3\n4\n5\n6\n8\n9\n", 1,
+			[]string{"@@ -1 +1,2 @@", "+0", " 1", "@@ -6,3 +7,2 @@", " 6", "-7", " 8"},
+		},
+	}
+	for _, tt := range tests {
+		got := Unified(SplitLines(tt.a), SplitLines(tt.b), tt.context)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Unified = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestLinesMinimal checks that Lines turns a into b with the fewest edits,
+// n+m-2*LCS, on random inputs over a small alphabet.
+func TestLinesMinimal(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	randomLines := func() []string {
+		lines := make([]string, r.IntN(10))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.IntN(3)))
+		}
+		return lines
+	}
+	cases := [][2][]string{
+		{strings.Split("bacbcaca", ""), strings.Split("bcbcbbaa", "")},
+	}
+	for range 5000 {
+		cases = append(cases, [2][]string{randomLines(), randomLines()})
+	}
+
+	for _, c := range cases {
+		a, b := c[0], c[1]
+		script := Lines(a, b)
+		var gotA, gotB []string
+		edits := 0
+		for _, l := range script {
+			if l.Op != Insert {
+				gotA = append(gotA, l.Text)
+			}
+			if l.Op != Delete {
+				gotB = append(gotB, l.Text)
+			}
+			if l.Op != Equal {
+				edits++
+			}
+		}
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("Lines(%q, %q) = %v does not turn a into b", a, b, script)
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); edits != want {
+			t.Fatalf("Lines(%q, %q) = %v has %d edits, want %d", a, b, script, edits, want)
+		}
+	}
+}
+
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,130 @@
+// Package history persists shell command history between sessions, one file
+// per target plus a global file shared by all of them.
+package history
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kui/internal/xdg"
+)
+
+// MaxEntries is how many commands are kept per file.
+const MaxEntries = 1000
+
+const globalKey = "global"
+
+// Store reads and appends history files under $XDG_STATE_HOME/kcmd/history
+// (~/.local/state/kcmd/history). A nil Store keeps nothing.
+type Store struct {
+	dir string
+}
+
+// Open returns the store for the current user. It fails only when no home
+// directory can be found; the directory itself is created on first write.
+func Open() (*Store, error) {
+	dir, err := xdg.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Store{dir: filepath.Join(dir, "history")}, nil
+}
+
+// Key names the history of a target. Pods that belong to a workload share
+// the workload's history, so it survives rollouts.
+func Key(kubeContext, namespace, kind, name string) string {
+	return url.PathEscape(strings.Join([]string{kubeContext, namespace, kind, name}, "/"))
+}
+
+// Load returns the history for key, oldest first. A target without history
+// of its own gets the global history instead.
+func (s *Store) Load(key string) ([]string, error) {
+	if s == nil {
+		return nil, nil
+	}
+	cmds, err := s.read(key)
+	if err != nil || len(cmds) > 0 {
+		return cmds, err
+	}
+	return s.read(globalKey)
+}
+
+// Global returns the history of all targets, oldest first.
+func (s *Store) Global() ([]string, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return s.read(globalKey)
+}
+
+// Append records cmd in the history for key and in the global history.
+func (s *Store) Append(key, cmd string) error {
+	if s == nil || strings.ContainsRune(cmd, '\n') {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	for _, k := range []string{key, globalKey} {
+		if err := s.append(k, cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) path(key string) string {
+	return filepath.Join(s.dir, key)
+}
+
+func (s *Store) append(key, cmd string) error {
+	f, err := os.OpenFile(s.path(key), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(cmd + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// read returns the last MaxEntries commands in the file and rewrites it when
+// it has grown well past that.
+func (s *Store) read(key string) ([]string, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cmds []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" {
+			cmds = append(cmds, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(cmds) > MaxEntries {
+		trimmed := len(cmds) > 2*MaxEntries
+		cmds = cmds[len(cmds)-MaxEntries:]
+		if trimmed {
+			data := strings.Join(cmds, "\n") + "\n"
+			_ = os.WriteFile(s.path(key), []byte(data), 0o600)
+		}
+	}
+	return cmds, nil
+}
@@ -0,0 +1,160 @@
+// Package journal records PodSecurity label changes before they are applied,
+// so that a change left behind by a crash or a killed terminal can be rolled
+// back on the next start.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"kui/internal/xdg"
+)
+
+// Entry is one label change. Original is the enforce label before the change;
+// empty means the namespace had none.
+type Entry struct {
+	ID         string    `json:"id"`
+	PID        int       `json:"pid"`
+	Time       time.Time `json:"time"`
+	Kubeconfig string    `json:"kubeconfig,omitempty"`
+	Context    string    `json:"context"`
+	Namespace  string    `json:"namespace"`
+	Original   string    `json:"original"`
+	Applied    string    `json:"applied"`
+}
+
+// record is a line in the journal file: an entry, or a marker saying that
+// the entry with ID has been restored or was never applied.
+type record struct {
+	Entry
+	Done bool `json:"done,omitempty"`
+}
+
+// Journal is an append-only file under $XDG_STATE_HOME/kcmd
+// (~/.local/state/kcmd). Changes are rare, so it is never compacted.
+type Journal struct {
+	path string
+}
+
+// Open returns the journal for the current user. It fails only when no home
+// directory can be found; the file itself is created on first write.
+func Open() (*Journal, error) {
+	dir, err := xdg.StateDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{path: filepath.Join(dir, "podsecurity.journal")}, nil
+}
+
+// Record writes e, stamped with an ID, the current pid and time, and syncs
+// it to disk. The change must not be applied when Record fails.
+func (j *Journal) Record(e Entry) (Entry, error) {
+	if j == nil {
+		return Entry{}, errors.New("no journal")
+	}
+	e.PID = os.Getpid()
+	e.Time = time.Now()
+	e.ID = fmt.Sprintf("%d-%d", e.PID, e.Time.UnixNano())
+	return e, j.append(record{Entry: e})
+}
+
+// Done marks the entry with id as finished.
+func (j *Journal) Done(id string) error {
+	if j == nil {
+		return nil
+	}
+	return j.append(record{Entry: Entry{ID: id}, Done: true})
+}
+
+// Pending returns the entries that are not done, oldest first.
+func (j *Journal) Pending() ([]Entry, error) {
+	if j == nil {
+		return nil, nil
+	}
+	f, err := os.Open(j.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	done := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r record
+		// A line cut short by a crash is skipped.
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil || r.ID == "" {
+			continue
+		}
+		if r.Done {
+			done[r.ID] = true
+		} else {
+			entries = append(entries, r.Entry)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	pending := entries[:0]
+	for _, e := range entries {
+		if !done[e.ID] {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+// Own returns the pending entries written by this process.
+func (j *Journal) Own() ([]Entry, error) {
+	entries, err := j.Pending()
+	if err != nil {
+		return nil, err
+	}
+	own := entries[:0]
+	for _, e := range entries {
+		if e.PID == os.Getpid() {
+			own = append(own, e)
+		}
+	}
+	return own, nil
+}
+
+func (j *Journal) append(r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	// Start a new line if a crash cut the last record short.
+	if st, err := f.Stat(); err == nil && st.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, st.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
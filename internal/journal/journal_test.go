@@ -0,0 +1,116 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func open(t *testing.T) *Journal {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	j, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+// appendRaw writes s to the journal file as is.
+func appendRaw(t *testing.T, j *Journal, s string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ids(entries []Entry) []string {
+	var res []string
+	for _, e := range entries {
+		res = append(res, e.ID)
+	}
+	return res
+}
+
+func TestPendingAndOwn(t *testing.T) {
+	j := open(t)
+	if entries, err := j.Pending(); err != nil || len(entries) != 0 {
+		t.Fatalf("empty journal: %v, %v", entries, err)
+	}
+
+	// Another kcmd, possibly still running.
+	appendRaw(t, j, `{"id":"other","pid":1,"context":"prod","namespace":"shop","original":"restricted","applied":"privileged"}`+"\n")
+	done, err := j.Record(Entry{Context: "dev", Namespace: "a", Applied: "privileged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mine, err := j.Record(Entry{Context: "dev", Namespace: "b", Original: "baseline", Applied: "privileged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Done(done.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := j.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(pending); len(got) != 2 || got[0] != "other" || got[1] != mine.ID {
+		t.Fatalf("pending = %q", got)
+	}
+	if pending[1].Original != "baseline" || pending[1].Namespace != "b" || pending[1].PID != os.Getpid() {
+		t.Fatalf("entry = %+v", pending[1])
+	}
+
+	own, err := j.Own()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(own); len(got) != 1 || got[0] != mine.ID {
+		t.Fatalf("own = %q", got)
+	}
+}
+
+func TestTruncatedLine(t *testing.T) {
+	j := open(t)
+	first, err := j.Record(Entry{Namespace: "a", Applied: "privileged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A crash in the middle of a write.
+	appendRaw(t, j, `{"id":"cut","pid":1,"namesp`)
+	second, err := j.Record(Entry{Namespace: "b", Applied: "privileged"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := j.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(pending); len(got) != 2 || got[0] != first.ID || got[1] != second.ID {
+		t.Fatalf("pending = %q", got)
+	}
+}
+
+func TestNilJournal(t *testing.T) {
+	var j *Journal
+	if _, err := j.Record(Entry{}); err == nil {
+		t.Fatal("Record on a nil journal succeeded")
+	}
+	if err := j.Done("x"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := j.Pending(); err != nil || entries != nil {
+		t.Fatalf("Pending = %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,177 @@
+package kubectl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"kui/internal/types"
+)
+
+const killTimeout = 10 * time.Second
+
+// Backend is the set of cluster operations the TUI depends on. The CLI
+// backend shells out to the kubectl binary; other implementations can talk
+// to the API server directly or serve canned data in tests.
+type Backend interface {
+	// GetContexts returns the contexts in the merged kubeconfig and the one
+	// currently in use.
+	GetContexts() ([]string, string, error)
+	UseContext(name string) error
+
+	GetNamespaces() ([]string, error)
+	GetNamesInNS(namespace string, kind types.ResType) ([]string, error)
+	GetPods(namespace string) ([]types.PodInfo, error)
+	// GetPodsForWorkload returns the pods owned by a workload, following
+	// ownerReferences through ReplicaSets and Jobs.
+	GetPodsForWorkload(namespace string, kind types.ResType, name string) ([]types.PodInfo, error)
+	// GetContainers returns the pod's regular, init (including native
+	// sidecar) and ephemeral containers with their current state.
+	GetContainers(namespace, pod string) ([]types.ContainerInfo, error)
+
+	GetPodSecurityPolicy(namespace string) (string, error)
+	SetPodSecurityPolicy(namespace, policy string) error
+
+	// CreateDebugContainer adds an ephemeral container built from profile
+	// and returns its name and how the target's filesystem is reached.
+	CreateDebugContainer(namespace, pod, targetContainer string, profile DebugProfile) (string, string, error)
+	// FindDebugContainer returns the newest kcmd debug container on pod that
+	// targets targetContainer with the same profile, and whether it is still
+	// running. The name is empty when there is none.
+	FindDebugContainer(namespace, pod, targetContainer string, profile DebugProfile) (string, bool, error)
+	WaitForDebugContainerReady(namespace, pod, debugContainer string) error
+	DeletePod(namespace, pod string) error
+
+	// Stream runs cmdline as described by spec, writing output to stdout
+	// and stderr as it is produced. Cancelling ctx closes the exec stream.
+	Stream(ctx context.Context, spec ExecSpec, cmdline string, stdout, stderr io.Writer) error
+}
+
+// ExecSpec identifies where a shell command runs. When DebugContainer is set
+// the command runs in the ephemeral debug container against the target
+// container's filesystem, reached through TargetRoot.
+type ExecSpec struct {
+	Namespace      string
+	Pod            string
+	Container      string
+	DebugContainer string
+	TargetRoot     string
+	CurrentDir     string
+	// Env is replayed in front of every command.
+	Env []EnvVar
+	// Stdin, when set, is streamed to the command's standard input.
+	Stdin io.Reader
+	// PIDFile, when set, is where the remote shell records its pid so that
+	// Kill can stop the command after the exec stream is gone.
+	PIDFile string
+}
+
+// command returns the container to exec in and the argv that runs cmdline.
+func (s ExecSpec) command(cmdline string) (string, []string) {
+	cmdline = envPrefix(s.Env) + cmdline
+	if s.PIDFile != "" {
+		cmdline = trackPID(s.PIDFile, cmdline)
+	}
+	if s.DebugContainer != "" {
+		return s.DebugContainer, debugCommand(s.TargetRoot, cmdline, s.CurrentDir)
+	}
+	return s.Container, podCommand(cmdline, s.CurrentDir)
+}
+
+// Exec runs cmdline and returns its buffered stdout and stderr.
+func Exec(ctx context.Context, b Backend, spec ExecSpec, cmdline string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := b.Stream(ctx, spec, cmdline, &stdout, &stderr)
+	return stdout.String(), stderr.String(), err
+}
+
+// ExitCode returns the remote exit status carried by an error from Stream:
+// 0 for nil and -1 when the command did not run to completion.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var status interface{ ExitStatus() int }
+	if errors.As(err, &status) {
+		return status.ExitStatus()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// execError prefers the remote stderr over the transport error.
+func execError(stderr string, err error) error {
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return errors.New(msg)
+	}
+	return err
+}
+
+// ResolveDir runs cd in the container, relative to spec.CurrentDir, and
+// returns the resulting absolute directory. arg is passed to cd as typed; an
+// empty arg means the home directory. When the target is reached through
+// /proc/<pid>/root the path is returned relative to that root and cd cannot
+// leave it.
+func ResolveDir(ctx context.Context, b Backend, spec ExecSpec, arg string) (string, error) {
+	root := ""
+	if spec.DebugContainer != "" && !strings.HasPrefix(spec.TargetRoot, "NSENTER:") {
+		root = strings.TrimSuffix(spec.TargetRoot, "/")
+		if arg == "" || arg == "~" {
+			arg = "/"
+		}
+		if strings.HasPrefix(arg, "/") {
+			arg = root + arg
+		}
+	}
+
+	cmdline := "cd && pwd"
+	if arg != "" {
+		cmdline = fmt.Sprintf("cd %s && pwd", arg)
+	}
+	spec.PIDFile = ""
+	stdout, stderr, err := Exec(ctx, b, spec, cmdline)
+	if err != nil {
+		return "", execError(stderr, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	dir := strings.TrimSpace(lines[len(lines)-1])
+	if root != "" {
+		rel, ok := strings.CutPrefix(dir, root)
+		if !ok || (rel != "" && !strings.HasPrefix(rel, "/")) {
+			return "/", nil
+		}
+		if rel == "" {
+			rel = "/"
+		}
+		dir = rel
+	}
+	if !strings.HasPrefix(dir, "/") {
+		return "", fmt.Errorf("unexpected pwd output %q", dir)
+	}
+	return dir, nil
+}
+
+// Kill stops the command started with spec.PIDFile. Closing the exec stream
+// does not stop the remote process, so it is signalled with a second exec;
+// this is best effort and fails quietly when the container lacks kill/pkill.
+func Kill(b Backend, spec ExecSpec) error {
+	if spec.PIDFile == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
+	defer cancel()
+	cmdline := killCommand(spec.PIDFile)
+	spec.PIDFile = ""
+	spec.Env = nil
+	_, _, err := Exec(ctx, b, spec, cmdline)
+	return err
+}
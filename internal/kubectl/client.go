@@ -2,14 +2,19 @@ package kubectl
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os/exec"
 	"sort"
 	"strings"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	"kui/internal/types"
 )
 
@@ -27,35 +32,102 @@ type kMeta struct {
 	Name string `json:"name"`
 }
 
+type kObject struct {
+	Metadata metav1.ObjectMeta `json:"metadata"`
+}
+
 type kWorkload struct {
-	Metadata kMeta `json:"metadata"`
+	Metadata metav1.ObjectMeta `json:"metadata"`
 	Spec     struct {
-		Selector struct {
-			MatchLabels map[string]string `json:"matchLabels"`
-		} `json:"selector"`
+		Selector *metav1.LabelSelector `json:"selector"`
 	} `json:"spec"`
+	// Status.Active is a count for Jobs and a list of Job references for
+	// CronJobs, so it is decoded by kind.
+	Status struct {
+		Active json.RawMessage `json:"active"`
+	} `json:"status"`
 }
 
-type kPod struct {
-	Metadata kMeta `json:"metadata"`
-	Spec     struct {
-		Containers []struct {
-			Name string `json:"name"`
-		} `json:"containers"`
-	} `json:"spec"`
+// CLI is the Backend that runs every operation through the kubectl binary.
+// Kubeconfig and context are passed as global flags on every invocation.
+type CLI struct {
+	kubeconfig string
+	context    string
 }
 
-func Run(args ...string) ([]byte, []byte, error) {
-	cmd := exec.Command("kubectl", args...)
+var _ Backend = (*CLI)(nil)
+
+func NewCLI(kubeconfig, contextName string) *CLI {
+	return &CLI{kubeconfig: kubeconfig, context: contextName}
+}
+
+// Run runs kubectl and returns its buffered output. Cancelling ctx kills the
+// kubectl process.
+func Run(ctx context.Context, args ...string) ([]byte, []byte, error) {
 	var out, errb bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &errb
-	e := cmd.Run()
+	e := RunStream(ctx, &out, &errb, args...)
 	return out.Bytes(), errb.Bytes(), e
 }
 
-func GetNamespaces() ([]string, error) {
-	out, errb, err := Run("get", "ns", "-o", "json")
+// RunStream runs kubectl with its output connected to stdout and stderr as
+// it is produced.
+func RunStream(ctx context.Context, stdout, stderr io.Writer, args ...string) error {
+	return runStream(ctx, nil, stdout, stderr, args...)
+}
+
+func runStream(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+func (c *CLI) globalArgs() []string {
+	var args []string
+	if c.kubeconfig != "" {
+		args = append(args, "--kubeconfig", c.kubeconfig)
+	}
+	if c.context != "" {
+		args = append(args, "--context", c.context)
+	}
+	return args
+}
+
+func (c *CLI) run(args ...string) ([]byte, []byte, error) {
+	return Run(context.Background(), append(c.globalArgs(), args...)...)
+}
+
+func (c *CLI) GetContexts() ([]string, string, error) {
+	out, errb, err := c.run("config", "get-contexts", "-o", "name")
+	if err != nil {
+		return nil, "", fmt.Errorf("kubectl config get-contexts: %w: %s", err, strings.TrimSpace(string(errb)))
+	}
+	var res []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+
+	current := c.context
+	if current == "" {
+		out, _, err := c.run("config", "current-context")
+		if err == nil {
+			current = strings.TrimSpace(string(out))
+		}
+	}
+	return res, current, nil
+}
+
+func (c *CLI) UseContext(name string) error {
+	c.context = name
+	return nil
+}
+
+func (c *CLI) GetNamespaces() ([]string, error) {
+	out, errb, err := c.run("get", "ns", "-o", "json")
 	if err != nil {
 		return nil, fmt.Errorf("kubectl get ns: %w: %s", err, strings.TrimSpace(string(errb)))
 	}
@@ -71,9 +143,9 @@ func GetNamespaces() ([]string, error) {
 	return res, nil
 }
 
-func GetNamesInNS(namespace string, kind types.ResType) ([]string, error) {
+func (c *CLI) GetNamesInNS(namespace string, kind types.ResType) ([]string, error) {
 	args := []string{"-n", namespace, "get", string(kind), "-o", "json"}
-	out, errb, err := Run(args...)
+	out, errb, err := c.run(args...)
 	if err != nil {
 		return nil, fmt.Errorf("kubectl get %s: %w: %s", kind, err, strings.TrimSpace(string(errb)))
 	}
@@ -93,70 +165,87 @@ func GetNamesInNS(namespace string, kind types.ResType) ([]string, error) {
 	return res, nil
 }
 
-func GetSelectorForWorkload(namespace string, kind types.ResType, name string) (string, error) {
-	if kind != types.RtDeployment && kind != types.RtStatefulSet {
-		return "", errors.New("selector only supported for deployment/statefulset")
+func (c *CLI) GetPods(namespace string) ([]types.PodInfo, error) {
+	pods, err := c.listPods(namespace, "")
+	if err != nil {
+		return nil, err
 	}
-	out, errb, err := Run("-n", namespace, "get", string(kind), name, "-o", "json")
+	return podInfos(pods), nil
+}
+
+func (c *CLI) GetPodsForWorkload(namespace string, kind types.ResType, name string) ([]types.PodInfo, error) {
+	return podsForWorkload(c, namespace, kind, name)
+}
+
+func (c *CLI) getWorkload(namespace string, kind types.ResType, name string) (workload, error) {
+	out, errb, err := c.run("-n", namespace, "get", string(kind), name, "-o", "json")
 	if err != nil {
-		return "", fmt.Errorf("kubectl get %s/%s: %w: %s", kind, name, err, strings.TrimSpace(string(errb)))
+		return workload{}, fmt.Errorf("kubectl get %s/%s: %w: %s", kind, name, err, strings.TrimSpace(string(errb)))
 	}
 	var wl kWorkload
 	if e := json.Unmarshal(out, &wl); e != nil {
-		return "", e
-	}
-	if len(wl.Spec.Selector.MatchLabels) == 0 {
-		return "", errors.New("matchLabels empty; kan ikke auto-finne pods")
+		return workload{}, e
 	}
-	keys := make([]string, 0, len(wl.Spec.Selector.MatchLabels))
-	for k := range wl.Spec.Selector.MatchLabels {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	parts := make([]string, 0, len(keys))
-	for _, k := range keys {
-		parts = append(parts, fmt.Sprintf("%s=%s", k, wl.Spec.Selector.MatchLabels[k]))
+	res := workload{meta: wl.Metadata, selector: wl.Spec.Selector}
+	if kind == types.RtCronJob && len(wl.Status.Active) > 0 {
+		if e := json.Unmarshal(wl.Status.Active, &res.active); e != nil {
+			return workload{}, e
+		}
 	}
-	return strings.Join(parts, ","), nil
+	return res, nil
 }
 
-func GetPodsBySelector(namespace, selector string) ([]string, error) {
-	out, errb, err := Run("-n", namespace, "get", "pods", "-l", selector, "-o", "json")
+func (c *CLI) listObjects(namespace string, kind types.ResType, selector string) ([]metav1.ObjectMeta, error) {
+	args := []string{"-n", namespace, "get", string(kind), "-o", "json"}
+	if selector != "" {
+		args = append(args, "-l", selector)
+	}
+	out, errb, err := c.run(args...)
 	if err != nil {
-		return nil, fmt.Errorf("kubectl get pods -l %q: %w: %s", selector, err, strings.TrimSpace(string(errb)))
+		return nil, fmt.Errorf("kubectl get %s: %w: %s", kind, err, strings.TrimSpace(string(errb)))
 	}
-	var parsed kList[kPod]
+	var parsed kList[kObject]
 	if e := json.Unmarshal(out, &parsed); e != nil {
 		return nil, e
 	}
-	var res []string
+	res := make([]metav1.ObjectMeta, 0, len(parsed.Items))
 	for _, it := range parsed.Items {
-		res = append(res, it.Metadata.Name)
+		res = append(res, it.Metadata)
 	}
-	sort.Strings(res)
 	return res, nil
 }
 
-func GetContainers(namespace, pod string) ([]string, error) {
-	out, errb, err := Run("-n", namespace, "get", "pod", pod, "-o", "json")
+func (c *CLI) listPods(namespace, selector string) ([]corev1.Pod, error) {
+	args := []string{"-n", namespace, "get", "pods", "-o", "json"}
+	if selector != "" {
+		args = append(args, "-l", selector)
+	}
+	out, errb, err := c.run(args...)
+	if err != nil {
+		return nil, fmt.Errorf("kubectl get pods -l %q: %w: %s", selector, err, strings.TrimSpace(string(errb)))
+	}
+	var parsed corev1.PodList
+	if e := json.Unmarshal(out, &parsed); e != nil {
+		return nil, e
+	}
+	return parsed.Items, nil
+}
+
+func (c *CLI) GetContainers(namespace, pod string) ([]types.ContainerInfo, error) {
+	out, errb, err := c.run("-n", namespace, "get", "pod", pod, "-o", "json")
 	if err != nil {
 		return nil, fmt.Errorf("kubectl get pod/%s: %w: %s", pod, err, strings.TrimSpace(string(errb)))
 	}
-	var p kPod
+	var p corev1.Pod
 	if e := json.Unmarshal(out, &p); e != nil {
 		return nil, e
 	}
-	var res []string
-	for _, c := range p.Spec.Containers {
-		res = append(res, c.Name)
-	}
-	sort.Strings(res)
-	return res, nil
+	return containerInfos(&p), nil
 }
 
-func GetPodSecurityPolicy(namespace string) (string, error) {
+func (c *CLI) GetPodSecurityPolicy(namespace string) (string, error) {
 	args := []string{"get", "namespace", namespace, "-o", "jsonpath={.metadata.labels.pod-security\\.kubernetes\\.io/enforce}"}
-	out, _, err := Run(args...)
+	out, _, err := c.run(args...)
 	if err != nil {
 		return "", err
 	}
@@ -167,10 +256,10 @@ func GetPodSecurityPolicy(namespace string) (string, error) {
 	return policy, nil
 }
 
-func SetPodSecurityPolicy(namespace, policy string) error {
+func (c *CLI) SetPodSecurityPolicy(namespace, policy string) error {
 	if policy == "" {
 		args := []string{"label", "namespace", namespace, "pod-security.kubernetes.io/enforce-"}
-		_, stderr, err := Run(args...)
+		_, stderr, err := c.run(args...)
 		if err != nil {
 			return fmt.Errorf("failed to remove PodSecurity policy label: %w (stderr: %s)", err, string(stderr))
 		}
@@ -178,36 +267,19 @@ func SetPodSecurityPolicy(namespace, policy string) error {
 	}
 
 	args := []string{"label", "namespace", namespace, fmt.Sprintf("pod-security.kubernetes.io/enforce=%s", policy), "--overwrite"}
-	_, stderr, err := Run(args...)
+	_, stderr, err := c.run(args...)
 	if err != nil {
 		return fmt.Errorf("failed to set PodSecurity policy: %w (stderr: %s)", err, string(stderr))
 	}
 	return nil
 }
 
-func CreateDebugContainer(namespace, pod, targetContainer string) (string, string, error) {
-	debugName := fmt.Sprintf("kcmd-debug-%d", time.Now().Unix())
-
-	ephemeralContainer := map[string]any{
-		"name":                debugName,
-		"image":               "busybox:latest",
-		"targetContainerName": targetContainer,
-		"command":             []string{"sleep", "3600"},
-		"securityContext": map[string]any{
-			"allowPrivilegeEscalation": false,
-			"runAsUser":                0,
-			"capabilities": map[string]any{
-				"drop": []string{"ALL"},
-				"add":  []string{"SYS_ADMIN", "SYS_CHROOT", "SYS_PTRACE"},
-			},
-			"seccompProfile": map[string]any{
-				"type": "RuntimeDefault",
-			},
-		},
-	}
+func (c *CLI) CreateDebugContainer(namespace, pod, targetContainer string, profile DebugProfile) (string, string, error) {
+	debugName := debugContainerName(time.Now().Unix())
+	ephemeralContainer := debugContainer(debugName, targetContainer, profile)
 
 	getPodCmd := []string{"get", "pod", pod, "-n", namespace, "-o", "json"}
-	podJSON, _, err := Run(getPodCmd...)
+	podJSON, _, err := c.run(getPodCmd...)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to get pod: %w", err)
 	}
@@ -236,7 +308,7 @@ func CreateDebugContainer(namespace, pod, targetContainer string) (string, strin
 		"-f", "-",
 	}
 
-	cmd := exec.Command("kubectl", patchCmd...)
+	cmd := exec.Command("kubectl", append(c.globalArgs(), patchCmd...)...)
 	cmd.Stdin = bytes.NewReader(patchedSpec)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -250,80 +322,59 @@ func CreateDebugContainer(namespace, pod, targetContainer string) (string, strin
 	for range 30 {
 		time.Sleep(500 * time.Millisecond)
 		checkCmd := []string{"get", "pod", pod, "-n", namespace, "-o", "jsonpath={.status.ephemeralContainerStatuses[?(@.name==\"" + debugName + "\")].state.running}"}
-		out, _, err := Run(checkCmd...)
+		out, _, err := c.run(checkCmd...)
 		if err == nil && len(out) > 0 && string(out) != "map[]" {
 			// Also verify we can exec into it
 			testCmd := []string{"-n", namespace, "exec", pod, "-c", debugName, "--", "echo", "ready"}
-			if _, _, execErr := Run(testCmd...); execErr == nil {
+			if _, _, execErr := c.run(testCmd...); execErr == nil {
 				break
 			}
 		}
 	}
 
-	pid := "1"
+	return debugName, DebugTargetRoot(c, namespace, pod, debugName), nil
+}
 
-	testNsenterCmd := []string{
-		"-n", namespace, "exec", pod,
-		"-c", debugName,
-		"--",
-		"sh", "-c",
-		fmt.Sprintf("nsenter -t %s -m -u -i -p -- pwd 2>&1", pid),
+func (c *CLI) FindDebugContainer(namespace, pod, targetContainer string, profile DebugProfile) (string, bool, error) {
+	out, errb, err := c.run("-n", namespace, "get", "pod", pod, "-o", "json")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get pod: %w: %s", err, strings.TrimSpace(string(errb)))
 	}
-	nsenterOut, _, nsenterErr := Run(testNsenterCmd...)
-
-	if nsenterErr == nil && strings.TrimSpace(string(nsenterOut)) != "" {
-		return debugName, fmt.Sprintf("NSENTER:%s", pid), nil
+	var p corev1.Pod
+	if err := json.Unmarshal(out, &p); err != nil {
+		return "", false, fmt.Errorf("failed to parse pod spec: %w", err)
 	}
-
-	targetRoot := fmt.Sprintf("/proc/%s/root", pid)
-	return debugName, targetRoot, nil
+	name, running := findDebugContainer(&p, targetContainer, profile)
+	return name, running, nil
 }
 
-func ExecInPod(namespace, pod, container, cmdline, currentDir string) (string, string, error) {
-	fullCmd := cmdline
-	if currentDir != "" {
-		fullCmd = fmt.Sprintf("cd %s && %s", currentDir, cmdline)
+func (c *CLI) Stream(ctx context.Context, spec ExecSpec, cmdline string, stdout, stderr io.Writer) error {
+	container, command := spec.command(cmdline)
+	args := []string{"-n", spec.Namespace, "exec", spec.Pod, "-c", container}
+	if spec.Stdin != nil {
+		args = append(args, "-i")
 	}
-	out, errb, err := Run("-n", namespace, "exec", pod, "-c", container, "--", "sh", "-lc", fullCmd)
-	return string(out), string(errb), err
+	args = append(append(args, "--"), command...)
+	return runStream(ctx, spec.Stdin, stdout, stderr, append(c.globalArgs(), args...)...)
 }
 
-func ExecInDebugContainer(namespace, pod, debugContainer, targetRoot, cmdline, currentDir string) (string, string, error) {
-	if _, ok := strings.CutPrefix(targetRoot, "NSENTER:"); ok {
-		pid := strings.TrimPrefix(targetRoot, "NSENTER:")
-
-		targetCmd := cmdline
-		if currentDir != "" && currentDir != "~" {
-			targetCmd = fmt.Sprintf("cd %s && %s", currentDir, cmdline)
-		}
-
-		escapedCmd := strings.ReplaceAll(targetCmd, "'", "'\"'\"'")
-		fullCmd := fmt.Sprintf("nsenter -t %s -m -u -i -p -- sh -c '%s'", pid, escapedCmd)
-
-		out, errb, err := Run("-n", namespace, "exec", pod, "-c", debugContainer, "--", "sh", "-c", fullCmd)
-		return string(out), string(errb), err
-	}
-
-	var fullCmd string
-	if currentDir != "" && currentDir != "~" {
-		fullCmd = fmt.Sprintf("cd %s%s && %s", targetRoot, currentDir, cmdline)
-	} else {
-		fullCmd = fmt.Sprintf("cd %s && %s", targetRoot, cmdline)
+func (c *CLI) DeletePod(namespace, pod string) error {
+	_, stderr, err := c.run("delete", "pod", pod, "-n", namespace)
+	if err != nil {
+		return fmt.Errorf("%w (stderr: %s)", err, string(stderr))
 	}
-
-	out, errb, err := Run("-n", namespace, "exec", pod, "-c", debugContainer, "--", "sh", "-c", fullCmd)
-	return string(out), string(errb), err
+	return nil
 }
 
 // WaitForDebugContainerReady waits for an ephemeral debug container to be ready
-func WaitForDebugContainerReady(namespace, pod, debugContainer string) error {
+func (c *CLI) WaitForDebugContainerReady(namespace, pod, debugContainer string) error {
 	maxRetries := 10
 
 	for range maxRetries {
 		time.Sleep(500 * time.Millisecond)
 
 		// Check container status
-		podJSON, _, err := Run("get", "pod", pod, "-n", namespace, "-o", "json")
+		podJSON, _, err := c.run("get", "pod", pod, "-n", namespace, "-o", "json")
 		if err != nil {
 			return fmt.Errorf("failed to get pod status: %w", err)
 		}
@@ -360,7 +411,7 @@ func WaitForDebugContainerReady(namespace, pod, debugContainer string) error {
 		}
 
 		// Try to execute a simple command
-		_, _, execErr := Run("-n", namespace, "exec", pod, "-c", debugContainer, "--", "echo", "ready")
+		_, _, execErr := c.run("-n", namespace, "exec", pod, "-c", debugContainer, "--", "echo", "ready")
 		if execErr == nil {
 			return nil
 		}
@@ -0,0 +1,196 @@
+package kubectl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+const (
+	debugImage = "busybox:latest"
+
+	// DefaultDebugProfile needs root and SYS_ADMIN so that nsenter into the
+	// target works.
+	DefaultDebugProfile = "default"
+
+	debugPrefix  = "kcmd-debug-"
+	probeTimeout = 15 * time.Second
+)
+
+// DebugProfile describes the ephemeral debug container. Base names one of
+// the built-in profiles, which mirror kubectl debug's general, baseline,
+// restricted, netadmin and sysadmin; fields that are set override it.
+type DebugProfile struct {
+	Name            string                  `json:"-"`
+	Base            string                  `json:"base,omitempty"`
+	Image           string                  `json:"image,omitempty"`
+	Command         []string                `json:"command,omitempty"`
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	Env             []corev1.EnvVar         `json:"env,omitempty"`
+	// Resources are rejected by the API server for ephemeral containers,
+	// which use the pod's spare resources; the field is only here to give a
+	// clear error.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// builtinProfiles returns the built-in profiles using image.
+func builtinProfiles(image string) map[string]DebugProfile {
+	root := int64(0)
+	yes, no := true, false
+	profile := func(name string, sc *corev1.SecurityContext) DebugProfile {
+		return DebugProfile{Name: name, Image: image, Command: []string{"sleep", "3600"}, SecurityContext: sc}
+	}
+	return map[string]DebugProfile{
+		DefaultDebugProfile: profile(DefaultDebugProfile, &corev1.SecurityContext{
+			AllowPrivilegeEscalation: &no,
+			RunAsUser:                &root,
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+				Add:  []corev1.Capability{"SYS_ADMIN", "SYS_CHROOT", "SYS_PTRACE"},
+			},
+			SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		}),
+		"general": profile("general", &corev1.SecurityContext{
+			Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"SYS_PTRACE"}},
+		}),
+		"baseline": profile("baseline", nil),
+		"restricted": profile("restricted", &corev1.SecurityContext{
+			AllowPrivilegeEscalation: &no,
+			RunAsNonRoot:             &yes,
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		}),
+		"netadmin": profile("netadmin", &corev1.SecurityContext{
+			Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN", "NET_RAW"}},
+		}),
+		"sysadmin": profile("sysadmin", &corev1.SecurityContext{Privileged: &yes}),
+	}
+}
+
+// DebugProfiles merges the built-in profiles with custom ones, applying
+// image (when set) to the built-ins. The result is sorted by name with the
+// default profile first.
+func DebugProfiles(image string, custom map[string]DebugProfile) ([]DebugProfile, error) {
+	if image == "" {
+		image = debugImage
+	}
+	profiles := builtinProfiles(image)
+	builtin := builtinProfiles(image)
+	for name, p := range custom {
+		baseName := p.Base
+		if baseName == "" {
+			baseName = DefaultDebugProfile
+		}
+		base, ok := builtin[baseName]
+		if !ok {
+			return nil, fmt.Errorf("debug profile %q: unknown base %q (default, general, baseline, restricted, netadmin or sysadmin)", name, p.Base)
+		}
+		if len(p.Resources.Limits) > 0 || len(p.Resources.Requests) > 0 || len(p.Resources.Claims) > 0 {
+			return nil, fmt.Errorf("debug profile %q: resources are not allowed for ephemeral containers", name)
+		}
+		if p.Image == "" {
+			p.Image = base.Image
+		}
+		if len(p.Command) == 0 {
+			p.Command = base.Command
+		}
+		if p.SecurityContext == nil {
+			p.SecurityContext = base.SecurityContext
+		}
+		p.Name = name
+		p.Base = baseName
+		profiles[name] = p
+	}
+
+	list := make([]DebugProfile, 0, len(profiles))
+	for _, p := range profiles {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if (list[i].Name == DefaultDebugProfile) != (list[j].Name == DefaultDebugProfile) {
+			return list[i].Name == DefaultDebugProfile
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// FindDebugProfile returns the profile called name.
+func FindDebugProfile(profiles []DebugProfile, name string) (DebugProfile, bool) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return DebugProfile{}, false
+}
+
+// debugContainer builds the ephemeral container for profile that targets
+// targetContainer.
+func debugContainer(name, targetContainer string, profile DebugProfile) corev1.EphemeralContainer {
+	if profile.Image == "" {
+		profile = builtinProfiles(debugImage)[DefaultDebugProfile]
+	}
+	return corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:            name,
+			Image:           profile.Image,
+			Command:         profile.Command,
+			Env:             profile.Env,
+			SecurityContext: profile.SecurityContext,
+		},
+		TargetContainerName: targetContainer,
+	}
+}
+
+// findDebugContainer returns the newest running kcmd debug container in p
+// that targets targetContainer and was built from profile. Ephemeral
+// containers are never restarted, so when none is running the newest one
+// that has exited is returned with running false.
+func findDebugContainer(p *corev1.Pod, targetContainer string, profile DebugProfile) (string, bool) {
+	want := debugContainer("", targetContainer, profile)
+	stopped := ""
+	for i := len(p.Spec.EphemeralContainers) - 1; i >= 0; i-- {
+		ec := p.Spec.EphemeralContainers[i]
+		if !strings.HasPrefix(ec.Name, debugPrefix) || ec.TargetContainerName != targetContainer {
+			continue
+		}
+		if ec.Image != want.Image ||
+			!equality.Semantic.DeepEqual(ec.Command, want.Command) ||
+			!equality.Semantic.DeepEqual(ec.Env, want.Env) ||
+			!equality.Semantic.DeepEqual(ec.SecurityContext, want.SecurityContext) {
+			continue
+		}
+		st := ephemeralStatus(p, ec.Name)
+		if st == nil {
+			continue
+		}
+		if st.State.Running != nil {
+			return ec.Name, true
+		}
+		if stopped == "" && st.State.Terminated != nil {
+			stopped = ec.Name
+		}
+	}
+	return stopped, false
+}
+
+// DebugTargetRoot reports how the target is reached from debugContainer:
+// "NSENTER:1" when nsenter into its namespaces works, otherwise through
+// /proc/1/root.
+func DebugTargetRoot(b Backend, namespace, pod, debugContainer string) string {
+	pid := "1"
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	spec := ExecSpec{Namespace: namespace, Pod: pod, Container: debugContainer}
+	out, _, err := Exec(ctx, b, spec, nsenterProbe(pid))
+	if err == nil && strings.TrimSpace(out) != "" {
+		return fmt.Sprintf("NSENTER:%s", pid)
+	}
+	return fmt.Sprintf("/proc/%s/root", pid)
+}
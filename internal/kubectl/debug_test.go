@@ -0,0 +1,68 @@
+package kubectl
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestFindDebugContainer(t *testing.T) {
+	profile := builtinProfiles(debugImage)["netadmin"]
+	profile.Env = []corev1.EnvVar{{Name: "TZ", Value: "Europe/Oslo"}}
+
+	otherEnv := profile
+	otherEnv.Env = []corev1.EnvVar{{Name: "TZ", Value: "UTC"}}
+	otherSC := profile
+	otherSC.SecurityContext = builtinProfiles(debugImage)["sysadmin"].SecurityContext
+
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	exited := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}
+
+	type container struct {
+		name, target string
+		profile      DebugProfile
+		state        corev1.ContainerState
+	}
+	pod := func(containers ...container) *corev1.Pod {
+		p := &corev1.Pod{}
+		for _, c := range containers {
+			ec := debugContainer(c.name, c.target, c.profile)
+			// Fields the API server fills in must not stop a match.
+			ec.TerminationMessagePath = corev1.TerminationMessagePathDefault
+			ec.ImagePullPolicy = corev1.PullAlways
+			p.Spec.EphemeralContainers = append(p.Spec.EphemeralContainers, ec)
+			p.Status.EphemeralContainerStatuses = append(p.Status.EphemeralContainerStatuses, corev1.ContainerStatus{Name: c.name, State: c.state})
+		}
+		return p
+	}
+
+	tests := []struct {
+		name        string
+		pod         *corev1.Pod
+		wantName    string
+		wantRunning bool
+	}{
+		{"none", pod(), "", false},
+		{"running", pod(container{"kcmd-debug-1", "app", profile, running}), "kcmd-debug-1", true},
+		{"other env", pod(container{"kcmd-debug-1", "app", otherEnv, running}), "", false},
+		{"other securityContext", pod(container{"kcmd-debug-1", "app", otherSC, running}), "", false},
+		{"other target", pod(container{"kcmd-debug-1", "sidecar", profile, running}), "", false},
+		{"not ours", pod(container{"debugger-1", "app", profile, running}), "", false},
+		{
+			"running wins over a newer exited one",
+			pod(container{"kcmd-debug-1", "app", profile, running}, container{"kcmd-debug-2", "app", profile, exited}),
+			"kcmd-debug-1", true,
+		},
+		{
+			"newest exited",
+			pod(container{"kcmd-debug-1", "app", profile, exited}, container{"kcmd-debug-2", "app", profile, exited}, container{"kcmd-debug-3", "app", otherEnv, running}),
+			"kcmd-debug-2", false,
+		},
+	}
+	for _, tt := range tests {
+		name, ok := findDebugContainer(tt.pod, "app", profile)
+		if name != tt.wantName || ok != tt.wantRunning {
+			t.Errorf("%s: findDebugContainer = %q, %v; want %q, %v", tt.name, name, ok, tt.wantName, tt.wantRunning)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package kubectl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EnvVar is a variable exported or unset by an earlier shell command.
+// Assignment holds the word as typed ("FOO=bar", `FOO="a b"`, "FOO"), so
+// quoting and expansions are replayed by the remote shell on every exec.
+type EnvVar struct {
+	Name       string
+	Assignment string
+	Unset      bool
+}
+
+func (v EnvVar) String() string {
+	if v.Unset {
+		return "unset " + v.Name
+	}
+	return "export " + v.Assignment
+}
+
+// ParseEnvCommand recognises a command line that only exports or unsets
+// variables, e.g. `export FOO=bar BAZ="a b"` or `unset FOO`. Anything else,
+// including export combined with other commands, is reported as not an env
+// command and runs remotely as usual.
+func ParseEnvCommand(cmdline string) ([]EnvVar, bool) {
+	words, ok := shellWords(cmdline)
+	if !ok || len(words) < 2 {
+		return nil, false
+	}
+	unset := false
+	switch words[0] {
+	case "export":
+	case "unset":
+		unset = true
+	default:
+		return nil, false
+	}
+
+	var vars []EnvVar
+	for _, w := range words[1:] {
+		name, _, hasValue := strings.Cut(w, "=")
+		if !validEnvName(name) || (unset && hasValue) {
+			return nil, false
+		}
+		vars = append(vars, EnvVar{Name: name, Assignment: w, Unset: unset})
+	}
+	return vars, true
+}
+
+// envPrefix returns the exports and unsets to run before a command, chained
+// with && so they fit in front of "cd dir && cmd".
+func envPrefix(env []EnvVar) string {
+	var b strings.Builder
+	for _, v := range env {
+		fmt.Fprintf(&b, "%s && ", v)
+	}
+	return b.String()
+}
+
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// shellWords splits cmdline on unquoted blanks, keeping quotes in the words.
+// It fails on unterminated quotes and on unquoted operators, so only simple
+// commands are accepted.
+func shellWords(cmdline string) ([]string, bool) {
+	var words []string
+	var cur strings.Builder
+	var quote rune
+	escaped := false
+	for _, r := range cmdline {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' {
+				escaped = true
+			}
+		case r == '\\':
+			escaped = true
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ' ' || r == '\t':
+			if cur.Len() > 0 {
+				words = append(words, cur.String())
+				cur.Reset()
+			}
+			continue
+		case strings.ContainsRune(";&|<>()`#\n", r):
+			return nil, false
+		}
+		cur.WriteRune(r)
+	}
+	if quote != 0 || escaped {
+		return nil, false
+	}
+	if cur.Len() > 0 {
+		words = append(words, cur.String())
+	}
+	return words, true
+}
@@ -0,0 +1,63 @@
+package kubectl
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestShellWords(t *testing.T) {
+	tests := []struct {
+		cmdline string
+		want    []string
+		ok      bool
+	}{
+		{"export FOO=bar", []string{"export", "FOO=bar"}, true},
+		{"  export \tFOO=bar  ", []string{"export", "FOO=bar"}, true},
+		{`export FOO="a b" BAR='c d'`, []string{"export", `FOO="a b"`, `BAR='c d'`}, true},
+		{`export FOO=a\ b`, []string{"export", `FOO=a\ b`}, true},
+		{`export FOO="say \"hi\""`, []string{"export", `FOO="say \"hi\""`}, true},
+		{`export FOO='a;b|c'`, []string{"export", `FOO='a;b|c'`}, true},
+		{`export FOO=a\;b`, []string{"export", `FOO=a\;b`}, true},
+		{`export FOO="a b`, nil, false},
+		{`export FOO='a b`, nil, false},
+		{`export FOO=a\`, nil, false},
+		{"export FOO=bar; ls", nil, false},
+		{"export FOO=bar && ls", nil, false},
+		{"export FOO=$(id -u)", nil, false},
+		{"export FOO=bar # note", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := shellWords(tt.cmdline)
+		if ok != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("shellWords(%q) = %q, %v; want %q, %v", tt.cmdline, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseEnvCommand(t *testing.T) {
+	tests := []struct {
+		cmdline string
+		want    []EnvVar
+		ok      bool
+	}{
+		{"export FOO=bar", []EnvVar{{Name: "FOO", Assignment: "FOO=bar"}}, true},
+		{`export FOO="a b" _X1=`, []EnvVar{{Name: "FOO", Assignment: `FOO="a b"`}, {Name: "_X1", Assignment: "_X1="}}, true},
+		{"export FOO", []EnvVar{{Name: "FOO", Assignment: "FOO"}}, true},
+		{"unset FOO BAR", []EnvVar{{Name: "FOO", Assignment: "FOO", Unset: true}, {Name: "BAR", Assignment: "BAR", Unset: true}}, true},
+		{"export", nil, false},
+		{"unset FOO=bar", nil, false},
+		{"export 1FOO=bar", nil, false},
+		{"export FOO-BAR=x", nil, false},
+		{`export FOO="unterminated`, nil, false},
+		// A prefix assignment applies to one command only and runs remotely.
+		{"FOO=bar env", nil, false},
+		{"FOO=bar", nil, false},
+		{"exporter FOO=bar", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseEnvCommand(tt.cmdline)
+		if ok != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("ParseEnvCommand(%q) = %+v, %v; want %+v, %v", tt.cmdline, got, ok, tt.want, tt.ok)
+		}
+	}
+}
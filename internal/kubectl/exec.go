@@ -0,0 +1,81 @@
+package kubectl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podCommand builds the argv that runs cmdline in a regular container.
+func podCommand(cmdline, currentDir string) []string {
+	fullCmd := cmdline
+	if currentDir != "" {
+		fullCmd = fmt.Sprintf("cd %s && %s", ShellQuote(currentDir), cmdline)
+	}
+	return []string{"sh", "-lc", fullCmd}
+}
+
+// debugCommand builds the argv that runs cmdline from the debug container
+// against the target container, either through nsenter or by chdir-ing into
+// the target's /proc/<pid>/root.
+func debugCommand(targetRoot, cmdline, currentDir string) []string {
+	if pid, ok := strings.CutPrefix(targetRoot, "NSENTER:"); ok {
+		targetCmd := cmdline
+		if currentDir != "" && currentDir != "~" {
+			targetCmd = fmt.Sprintf("cd %s && %s", ShellQuote(currentDir), cmdline)
+		}
+
+		fullCmd := fmt.Sprintf("nsenter -t %s -m -u -i -p -- sh -c %s", pid, ShellQuote(targetCmd))
+		return []string{"sh", "-c", fullCmd}
+	}
+
+	var fullCmd string
+	if currentDir != "" && currentDir != "~" {
+		fullCmd = fmt.Sprintf("cd %s && %s", ShellQuote(targetRoot+currentDir), cmdline)
+	} else {
+		fullCmd = fmt.Sprintf("cd %s && %s", targetRoot, cmdline)
+	}
+	return []string{"sh", "-c", fullCmd}
+}
+
+// ShellQuote quotes s as a single word for sh.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "'\"'\"'") + "'"
+}
+
+// trackPID wraps cmdline so the shell running it writes its pid to pidFile
+// first and removes the file when it exits. A pid file that cannot be
+// written (read-only /tmp) is ignored.
+func trackPID(pidFile, cmdline string) string {
+	return fmt.Sprintf("{ { echo $$ > %[1]s; } 2>/dev/null && trap 'rm -f %[1]s' EXIT; %[2]s\n}", pidFile, cmdline)
+}
+
+// killCommand signals the shell recorded in pidFile and its children.
+func killCommand(pidFile string) string {
+	return fmt.Sprintf(`p=$(cat %[1]s 2>/dev/null) && [ -n "$p" ] && { pkill -TERM -P "$p"; kill -TERM "$p"; rm -f %[1]s; } 2>/dev/null`, pidFile)
+}
+
+func debugContainerName(unix int64) string {
+	return fmt.Sprintf("%s%d", debugPrefix, unix)
+}
+
+// nsenterProbe returns the command line used to check whether nsenter into
+// the target's namespaces works from the debug container.
+func nsenterProbe(pid string) string {
+	return fmt.Sprintf("nsenter -t %s -m -u -i -p -- pwd 2>&1", pid)
+}
+
+// formatSelector converts a workload selector, including matchExpressions,
+// into the string form accepted by "kubectl get -l" and ListOptions.
+func formatSelector(selector *metav1.LabelSelector) (string, error) {
+	if selector == nil || (len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0) {
+		return "", errors.New("selector empty; kan ikke auto-finne pods")
+	}
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", fmt.Errorf("invalid selector: %w", err)
+	}
+	return sel.String(), nil
+}
@@ -0,0 +1,49 @@
+package kubectl
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFormatSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector *metav1.LabelSelector
+		want     string
+		wantErr  bool
+	}{
+		{"nil", nil, "", true},
+		{"empty", &metav1.LabelSelector{}, "", true},
+		{"labels", &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web", "tier": "front"}}, "app=web,tier=front", false},
+		{
+			"expressions",
+			&metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"staging", "prod"}},
+				{Key: "track", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"canary"}},
+				{Key: "team", Operator: metav1.LabelSelectorOpExists},
+				{Key: "legacy", Operator: metav1.LabelSelectorOpDoesNotExist},
+			}},
+			"env in (prod,staging),!legacy,team,track notin (canary)", false,
+		},
+		{
+			"labels and expressions",
+			&metav1.LabelSelector{
+				MatchLabels:      map[string]string{"app": "web"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"prod"}}},
+			},
+			"app=web,env in (prod)", false,
+		},
+		{
+			"unknown operator",
+			&metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: "Near"}}},
+			"", true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := formatSelector(tt.selector)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: formatSelector = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package kubectl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+
+	"kui/internal/types"
+)
+
+// Native is the Backend that talks to the API server through client-go, so
+// no kubectl binary is needed.
+type Native struct {
+	kubeconfig string
+	context    string
+
+	config *rest.Config
+	client kubernetes.Interface
+}
+
+var _ Backend = (*Native)(nil)
+
+// ErrNoCurrentContext is returned by NewNative when no context is given and
+// the kubeconfig names no current-context.
+var ErrNoCurrentContext = errors.New("kubeconfig has no current-context")
+
+// NewNative builds the client for contextName, or for the current-context
+// when it is empty.
+func NewNative(kubeconfig, contextName string) (*Native, error) {
+	n := &Native{kubeconfig: kubeconfig}
+	if contextName == "" && n.noCurrentContext() {
+		return nil, ErrNoCurrentContext
+	}
+	if err := n.UseContext(contextName); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// NewNativeUnbound returns a backend that can only list the kubeconfig's
+// contexts until UseContext picks one. It serves the wizard's context step
+// when the kubeconfig has no current-context.
+func NewNativeUnbound(kubeconfig string) *Native {
+	return &Native{kubeconfig: kubeconfig}
+}
+
+// noCurrentContext reports whether the kubeconfig loads but names no
+// current-context.
+func (n *Native) noCurrentContext() bool {
+	raw, err := n.clientConfig("").RawConfig()
+	return err == nil && raw.CurrentContext == "" && len(raw.Contexts) > 0
+}
+
+func (n *Native) clientConfig(contextName string) clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = n.kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: contextName})
+}
+
+func (n *Native) GetContexts() ([]string, string, error) {
+	raw, err := n.clientConfig(n.context).RawConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("load kubeconfig: %w", err)
+	}
+	var res []string
+	for name := range raw.Contexts {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+
+	current := n.context
+	if current == "" {
+		current = raw.CurrentContext
+	}
+	return res, current, nil
+}
+
+// UseContext rebuilds the client for the given context; an empty name means
+// the kubeconfig's current-context.
+func (n *Native) UseContext(name string) error {
+	config, err := n.clientConfig(name).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("load kubeconfig: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("create client: %w", err)
+	}
+	n.context = name
+	n.config = config
+	n.client = client
+	return nil
+}
+
+func (n *Native) GetNamespaces() ([]string, error) {
+	list, err := n.client.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list namespaces: %w", err)
+	}
+	var res []string
+	for _, it := range list.Items {
+		res = append(res, it.Name)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (n *Native) GetNamesInNS(namespace string, kind types.ResType) ([]string, error) {
+	ctx := context.Background()
+	var res []string
+	switch kind {
+	case types.RtPod:
+		list, err := n.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list pods: %w", err)
+		}
+		for _, it := range list.Items {
+			res = append(res, it.Name)
+		}
+	case types.RtDeployment:
+		list, err := n.client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list deployments: %w", err)
+		}
+		for _, it := range list.Items {
+			res = append(res, it.Name)
+		}
+	case types.RtStatefulSet:
+		list, err := n.client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list statefulsets: %w", err)
+		}
+		for _, it := range list.Items {
+			res = append(res, it.Name)
+		}
+	case types.RtDaemonSet:
+		list, err := n.client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list daemonsets: %w", err)
+		}
+		for _, it := range list.Items {
+			res = append(res, it.Name)
+		}
+	case types.RtReplicaSet:
+		list, err := n.client.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list replicasets: %w", err)
+		}
+		for _, it := range list.Items {
+			res = append(res, it.Name)
+		}
+	case types.RtJob:
+		list, err := n.client.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list jobs: %w", err)
+		}
+		for _, it := range list.Items {
+			res = append(res, it.Name)
+		}
+	case types.RtCronJob:
+		list, err := n.client.BatchV1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list cronjobs: %w", err)
+		}
+		for _, it := range list.Items {
+			res = append(res, it.Name)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind %q", kind)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (n *Native) GetPods(namespace string) ([]types.PodInfo, error) {
+	pods, err := n.listPods(namespace, "")
+	if err != nil {
+		return nil, err
+	}
+	return podInfos(pods), nil
+}
+
+func (n *Native) GetPodsForWorkload(namespace string, kind types.ResType, name string) ([]types.PodInfo, error) {
+	return podsForWorkload(n, namespace, kind, name)
+}
+
+func (n *Native) getWorkload(namespace string, kind types.ResType, name string) (workload, error) {
+	ctx := context.Background()
+	var wl workload
+	switch kind {
+	case types.RtDeployment:
+		d, err := n.client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return wl, fmt.Errorf("get %s/%s: %w", kind, name, err)
+		}
+		wl.meta = d.ObjectMeta
+		wl.selector = d.Spec.Selector
+	case types.RtStatefulSet:
+		s, err := n.client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return wl, fmt.Errorf("get %s/%s: %w", kind, name, err)
+		}
+		wl.meta = s.ObjectMeta
+		wl.selector = s.Spec.Selector
+	case types.RtDaemonSet:
+		d, err := n.client.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return wl, fmt.Errorf("get %s/%s: %w", kind, name, err)
+		}
+		wl.meta = d.ObjectMeta
+		wl.selector = d.Spec.Selector
+	case types.RtReplicaSet:
+		r, err := n.client.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return wl, fmt.Errorf("get %s/%s: %w", kind, name, err)
+		}
+		wl.meta = r.ObjectMeta
+		wl.selector = r.Spec.Selector
+	case types.RtJob:
+		j, err := n.client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return wl, fmt.Errorf("get %s/%s: %w", kind, name, err)
+		}
+		wl.meta = j.ObjectMeta
+		wl.selector = j.Spec.Selector
+	case types.RtCronJob:
+		c, err := n.client.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return wl, fmt.Errorf("get %s/%s: %w", kind, name, err)
+		}
+		wl.meta = c.ObjectMeta
+		wl.active = c.Status.Active
+	default:
+		return wl, fmt.Errorf("unsupported kind %q", kind)
+	}
+	return wl, nil
+}
+
+func (n *Native) listObjects(namespace string, kind types.ResType, selector string) ([]metav1.ObjectMeta, error) {
+	ctx := context.Background()
+	opts := metav1.ListOptions{LabelSelector: selector}
+	var res []metav1.ObjectMeta
+	switch kind {
+	case types.RtReplicaSet:
+		list, err := n.client.AppsV1().ReplicaSets(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("list replicasets: %w", err)
+		}
+		for _, it := range list.Items {
+			res = append(res, it.ObjectMeta)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind %q", kind)
+	}
+	return res, nil
+}
+
+func (n *Native) listPods(namespace, selector string) ([]corev1.Pod, error) {
+	list, err := n.client.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("list pods -l %q: %w", selector, err)
+	}
+	return list.Items, nil
+}
+
+func (n *Native) GetContainers(namespace, pod string) ([]types.ContainerInfo, error) {
+	p, err := n.client.CoreV1().Pods(namespace).Get(context.Background(), pod, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get pod/%s: %w", pod, err)
+	}
+	return containerInfos(p), nil
+}
+
+func (n *Native) GetPodSecurityPolicy(namespace string) (string, error) {
+	ns, err := n.client.CoreV1().Namespaces().Get(context.Background(), namespace, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return ns.Labels["pod-security.kubernetes.io/enforce"], nil
+}
+
+func (n *Native) SetPodSecurityPolicy(namespace, policy string) error {
+	var value any
+	if policy != "" {
+		value = policy
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"labels": map[string]any{"pod-security.kubernetes.io/enforce": value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = n.client.CoreV1().Namespaces().Patch(context.Background(), namespace, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		if policy == "" {
+			return fmt.Errorf("failed to remove PodSecurity policy label: %w", err)
+		}
+		return fmt.Errorf("failed to set PodSecurity policy: %w", err)
+	}
+	return nil
+}
+
+func (n *Native) CreateDebugContainer(namespace, pod, targetContainer string, profile DebugProfile) (string, string, error) {
+	ctx := context.Background()
+	debugName := debugContainerName(time.Now().Unix())
+
+	p, err := n.client.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get pod: %w", err)
+	}
+
+	p.Spec.EphemeralContainers = append(p.Spec.EphemeralContainers, debugContainer(debugName, targetContainer, profile))
+
+	if _, err := n.client.CoreV1().Pods(namespace).UpdateEphemeralContainers(ctx, pod, p, metav1.UpdateOptions{}); err != nil {
+		return "", "", fmt.Errorf("failed to create ephemeral container: %w", err)
+	}
+
+	// Wait for container to be running
+	for range 30 {
+		time.Sleep(500 * time.Millisecond)
+		p, err := n.client.CoreV1().Pods(namespace).Get(ctx, pod, metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+		if st := ephemeralStatus(p, debugName); st != nil && st.State.Running != nil {
+			if _, _, execErr := n.exec(namespace, pod, debugName, []string{"echo", "ready"}); execErr == nil {
+				break
+			}
+		}
+	}
+
+	return debugName, DebugTargetRoot(n, namespace, pod, debugName), nil
+}
+
+func (n *Native) FindDebugContainer(namespace, pod, targetContainer string, profile DebugProfile) (string, bool, error) {
+	p, err := n.client.CoreV1().Pods(namespace).Get(context.Background(), pod, metav1.GetOptions{})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get pod: %w", err)
+	}
+	name, running := findDebugContainer(p, targetContainer, profile)
+	return name, running, nil
+}
+
+// WaitForDebugContainerReady waits for an ephemeral debug container to be ready
+func (n *Native) WaitForDebugContainerReady(namespace, pod, debugContainer string) error {
+	maxRetries := 10
+
+	for range maxRetries {
+		time.Sleep(500 * time.Millisecond)
+
+		p, err := n.client.CoreV1().Pods(namespace).Get(context.Background(), pod, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get pod status: %w", err)
+		}
+
+		if st := ephemeralStatus(p, debugContainer); st != nil {
+			if st.Ready {
+				return nil
+			}
+			if w := st.State.Waiting; w != nil && w.Reason == "CreateContainerConfigError" {
+				return fmt.Errorf("debug container failed to start: %s\n\nThis namespace likely has additional policy enforcement (Kyverno/OPA) preventing root containers.\nSuggested workaround: temporarily disable the policy or use a non-root debug image", w.Message)
+			}
+		}
+
+		if _, _, execErr := n.exec(namespace, pod, debugContainer, []string{"echo", "ready"}); execErr == nil {
+			return nil
+		}
+	}
+
+	return errors.New("debug container did not become ready in time")
+}
+
+func (n *Native) DeletePod(namespace, pod string) error {
+	return n.client.CoreV1().Pods(namespace).Delete(context.Background(), pod, metav1.DeleteOptions{})
+}
+
+func (n *Native) Stream(ctx context.Context, spec ExecSpec, cmdline string, stdout, stderr io.Writer) error {
+	container, command := spec.command(cmdline)
+	return n.stream(ctx, spec.Namespace, spec.Pod, container, command, spec.Stdin, stdout, stderr)
+}
+
+// exec runs command through the pods/exec subresource. Errors that are not a
+// remote exit status are also written to stderr, the way kubectl reports them,
+// so callers can inspect a single stream.
+func (n *Native) exec(namespace, pod, container string, command []string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := n.stream(context.Background(), namespace, pod, container, command, nil, &stdout, &stderr)
+	return stdout.String(), stderr.String(), err
+}
+
+func (n *Native) stream(ctx context.Context, namespace, pod, container string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	req := n.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := n.executor(req.URL())
+	if err != nil {
+		return err
+	}
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	var exitErr interface{ ExitStatus() int }
+	if err != nil && !errors.As(err, &exitErr) {
+		fmt.Fprintln(stderr, err.Error())
+	}
+	return err
+}
+
+// executor prefers the WebSocket exec protocol and falls back to SPDY on
+// API servers that do not support it, like kubectl does.
+func (n *Native) executor(u *url.URL) (remotecommand.Executor, error) {
+	ws, err := remotecommand.NewWebSocketExecutor(n.config, "GET", u.String())
+	if err != nil {
+		return nil, err
+	}
+	spdy, err := remotecommand.NewSPDYExecutor(n.config, "POST", u)
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewFallbackExecutor(ws, spdy, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+}
+
+func ephemeralStatus(p *corev1.Pod, name string) *corev1.ContainerStatus {
+	for i := range p.Status.EphemeralContainerStatuses {
+		if p.Status.EphemeralContainerStatuses[i].Name == name {
+			return &p.Status.EphemeralContainerStatuses[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package kubectl
+
+import (
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"kui/internal/types"
+)
+
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// workloadLister is the lookup surface each backend provides so that the
+// ownership chain is followed the same way regardless of transport.
+type workloadLister interface {
+	getWorkload(namespace string, kind types.ResType, name string) (workload, error)
+	listObjects(namespace string, kind types.ResType, selector string) ([]metav1.ObjectMeta, error)
+	listPods(namespace, selector string) ([]corev1.Pod, error)
+}
+
+// workload is the part of a workload object that pod resolution needs.
+type workload struct {
+	meta metav1.ObjectMeta
+	// selector is nil for kinds without one (CronJob).
+	selector *metav1.LabelSelector
+	// active lists the Jobs a CronJob is running, from status.active.
+	active []corev1.ObjectReference
+}
+
+// podsForWorkload resolves the pods that belong to a workload by following
+// metadata.ownerReferences: Deployment → ReplicaSet → Pod, CronJob → active
+// Job → Pod, and a direct owner reference for the other kinds. The workload's
+// selector only narrows the list calls; a pod that matches the labels but is
+// owned by something else is left out.
+func podsForWorkload(l workloadLister, namespace string, kind types.ResType, name string) ([]types.PodInfo, error) {
+	wl, err := l.getWorkload(namespace, kind, name)
+	if err != nil {
+		return nil, err
+	}
+	sel := ""
+	if wl.selector != nil {
+		if sel, err = formatSelector(wl.selector); err != nil {
+			return nil, err
+		}
+	}
+
+	// owners maps the UID of each direct pod owner to the ReplicaSet
+	// details shown for its pods.
+	owners := map[k8stypes.UID]types.PodInfo{}
+	switch kind {
+	case types.RtDeployment:
+		replicaSets, err := l.listObjects(namespace, types.RtReplicaSet, sel)
+		if err != nil {
+			return nil, err
+		}
+		for _, rs := range replicaSets {
+			if ownedBy(rs, wl.meta.UID) {
+				revision, _ := strconv.Atoi(rs.Annotations[revisionAnnotation])
+				owners[rs.UID] = types.PodInfo{ReplicaSet: rs.Name, Revision: revision}
+			}
+		}
+	case types.RtCronJob:
+		// Finished Jobs keep their pods around until they are cleaned up;
+		// only the running ones are of interest.
+		for _, job := range wl.active {
+			owners[job.UID] = types.PodInfo{}
+		}
+	default:
+		owners[wl.meta.UID] = types.PodInfo{}
+	}
+	if len(owners) == 0 {
+		return nil, nil
+	}
+
+	pods, err := l.listPods(namespace, sel)
+	if err != nil {
+		return nil, err
+	}
+	var res []types.PodInfo
+	for _, p := range pods {
+		for _, ref := range p.OwnerReferences {
+			if via, ok := owners[ref.UID]; ok {
+				info := newPodInfo(&p)
+				info.ReplicaSet = via.ReplicaSet
+				info.Revision = via.Revision
+				res = append(res, info)
+				break
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func ownedBy(meta metav1.ObjectMeta, uid k8stypes.UID) bool {
+	for _, ref := range meta.OwnerReferences {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
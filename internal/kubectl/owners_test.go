@@ -0,0 +1,112 @@
+package kubectl
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+
+	"kui/internal/types"
+)
+
+// fakeLister serves fixed objects and ignores selectors, so that only the
+// ownership walk decides which pods are returned.
+type fakeLister struct {
+	workloads map[string]workload
+	objects   map[types.ResType][]metav1.ObjectMeta
+	pods      []corev1.Pod
+	selector  string
+}
+
+func (f *fakeLister) getWorkload(namespace string, kind types.ResType, name string) (workload, error) {
+	wl, ok := f.workloads[string(kind)+"/"+name]
+	if !ok {
+		return workload{}, fmt.Errorf("%s/%s not found", kind, name)
+	}
+	return wl, nil
+}
+
+func (f *fakeLister) listObjects(namespace string, kind types.ResType, selector string) ([]metav1.ObjectMeta, error) {
+	return f.objects[kind], nil
+}
+
+func (f *fakeLister) listPods(namespace, selector string) ([]corev1.Pod, error) {
+	f.selector = selector
+	return f.pods, nil
+}
+
+func meta(name, uid, owner string) metav1.ObjectMeta {
+	m := metav1.ObjectMeta{Name: name, UID: k8stypes.UID(uid), Labels: map[string]string{"app": "web"}}
+	if owner != "" {
+		m.OwnerReferences = []metav1.OwnerReference{{UID: k8stypes.UID(owner)}}
+	}
+	return m
+}
+
+func TestPodsForWorkload(t *testing.T) {
+	newRS := meta("web-2", "rs2", "deploy")
+	newRS.Annotations = map[string]string{revisionAnnotation: "2"}
+	oldRS := meta("web-1", "rs1", "deploy")
+	oldRS.Annotations = map[string]string{revisionAnnotation: "1"}
+
+	l := &fakeLister{
+		workloads: map[string]workload{
+			"deployment/web": {
+				meta:     meta("web", "deploy", ""),
+				selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			},
+			"cronjob/nightly": {
+				meta:   meta("nightly", "cron", ""),
+				active: []corev1.ObjectReference{{Name: "nightly-2", UID: "job2"}},
+			},
+			"statefulset/db": {
+				meta:     meta("db", "sts", ""),
+				selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			},
+		},
+		objects: map[types.ResType][]metav1.ObjectMeta{
+			types.RtReplicaSet: {newRS, oldRS, meta("other-1", "rs9", "other")},
+		},
+		pods: []corev1.Pod{
+			{ObjectMeta: meta("web-2-a", "p1", "rs2")},
+			{ObjectMeta: meta("web-1-a", "p2", "rs1")},
+			// Same labels, but owned by another workload's ReplicaSet.
+			{ObjectMeta: meta("other-1-a", "p3", "rs9")},
+			{ObjectMeta: meta("bare", "p4", "")},
+			{ObjectMeta: meta("nightly-2-a", "p5", "job2")},
+			// A finished Job that is no longer in status.active.
+			{ObjectMeta: meta("nightly-1-a", "p6", "job1")},
+			{ObjectMeta: meta("db-0", "p7", "sts")},
+		},
+	}
+
+	tests := []struct {
+		kind     types.ResType
+		name     string
+		want     []string
+		selector string
+	}{
+		{types.RtDeployment, "web", []string{"web-1-a rev 1 web-1", "web-2-a rev 2 web-2"}, "app=web"},
+		{types.RtCronJob, "nightly", []string{"nightly-2-a rev 0 "}, ""},
+		{types.RtStatefulSet, "db", []string{"db-0 rev 0 "}, "app=web"},
+	}
+	for _, tt := range tests {
+		pods, err := podsForWorkload(l, "ns", tt.kind, tt.name)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", tt.kind, tt.name, err)
+		}
+		var got []string
+		for _, p := range pods {
+			got = append(got, fmt.Sprintf("%s rev %d %s", p.Name, p.Revision, p.ReplicaSet))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s/%s: pods = %q, want %q", tt.kind, tt.name, got, tt.want)
+		}
+		if l.selector != tt.selector {
+			t.Errorf("%s/%s: pods listed with selector %q, want %q", tt.kind, tt.name, l.selector, tt.selector)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package kubectl
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"kui/internal/types"
+)
+
+func podInfos(pods []corev1.Pod) []types.PodInfo {
+	res := make([]types.PodInfo, 0, len(pods))
+	for i := range pods {
+		res = append(res, newPodInfo(&pods[i]))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func newPodInfo(p *corev1.Pod) types.PodInfo {
+	info := types.PodInfo{
+		Name:    p.Name,
+		Status:  podStatus(p),
+		Total:   len(p.Spec.Containers),
+		Node:    p.Spec.NodeName,
+		Created: p.CreationTimestamp.Time,
+	}
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Ready {
+			info.Ready++
+		}
+		info.Restarts += int(cs.RestartCount)
+	}
+	return info
+}
+
+// podStatus returns the same one-word status kubectl shows in its STATUS
+// column: a container's waiting or terminated reason wins over the phase.
+func podStatus(p *corev1.Pod) string {
+	if p.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	status := string(p.Status.Phase)
+	if p.Status.Reason != "" {
+		status = p.Status.Reason
+	}
+
+	for _, cs := range p.Status.InitContainerStatuses {
+		switch {
+		case cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0:
+			continue
+		case cs.State.Terminated != nil:
+			return "Init:" + nonEmpty(cs.State.Terminated.Reason, "Error")
+		case cs.State.Waiting != nil && cs.State.Waiting.Reason != "" && cs.State.Waiting.Reason != "PodInitializing":
+			return "Init:" + cs.State.Waiting.Reason
+		}
+	}
+
+	for _, cs := range p.Status.ContainerStatuses {
+		switch {
+		case cs.State.Waiting != nil && cs.State.Waiting.Reason != "":
+			status = cs.State.Waiting.Reason
+		case cs.State.Terminated != nil && cs.State.Terminated.Reason != "":
+			status = cs.State.Terminated.Reason
+		}
+	}
+	return status
+}
+
+func containerInfos(p *corev1.Pod) []types.ContainerInfo {
+	statuses := map[string]corev1.ContainerStatus{}
+	for _, list := range [][]corev1.ContainerStatus{p.Status.ContainerStatuses, p.Status.InitContainerStatuses, p.Status.EphemeralContainerStatuses} {
+		for _, cs := range list {
+			statuses[cs.Name] = cs
+		}
+	}
+	info := func(name string, kind types.ContainerKind) types.ContainerInfo {
+		state, running := containerState(statuses[name])
+		return types.ContainerInfo{Name: name, Kind: kind, State: state, Running: running}
+	}
+
+	var regular, sidecars, inits, ephemeral []types.ContainerInfo
+	for _, c := range p.Spec.Containers {
+		regular = append(regular, info(c.Name, types.ContainerRegular))
+	}
+	for _, c := range p.Spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			sidecars = append(sidecars, info(c.Name, types.ContainerSidecar))
+		} else {
+			inits = append(inits, info(c.Name, types.ContainerInit))
+		}
+	}
+	for _, c := range p.Spec.EphemeralContainers {
+		ephemeral = append(ephemeral, info(c.Name, types.ContainerEphemeral))
+	}
+
+	var res []types.ContainerInfo
+	for _, group := range [][]types.ContainerInfo{regular, sidecars, inits, ephemeral} {
+		sort.Slice(group, func(i, j int) bool { return group[i].Name < group[j].Name })
+		res = append(res, group...)
+	}
+	return res
+}
+
+func containerState(cs corev1.ContainerStatus) (string, bool) {
+	switch {
+	case cs.State.Running != nil:
+		return "running", true
+	case cs.State.Waiting != nil:
+		return "waiting: " + nonEmpty(cs.State.Waiting.Reason, "unknown"), false
+	case cs.State.Terminated != nil:
+		return "terminated: " + nonEmpty(cs.State.Terminated.Reason, "unknown"), false
+	default:
+		return "unknown", false
+	}
+}
+
+func nonEmpty(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
@@ -0,0 +1,193 @@
+package kubectl
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RemotePath describes a file or directory in the target container.
+type RemotePath struct {
+	Path string
+	Dir  bool
+	// Size is the file size in bytes, or -1 for directories.
+	Size int64
+}
+
+// fileSpec returns the spec used for file transfers. With nsenter the
+// target's own tools would be needed, so transfers go through
+// /proc/<pid>/root from the debug container instead.
+func (s ExecSpec) fileSpec() ExecSpec {
+	if pid, ok := strings.CutPrefix(s.TargetRoot, "NSENTER:"); ok {
+		s.TargetRoot = fmt.Sprintf("/proc/%s/root", pid)
+	}
+	s.PIDFile = ""
+	return s
+}
+
+// targetPath maps an absolute path in the target container to the path the
+// command sees. Only the /proc/<pid>/root route needs the prefix; relative
+// paths already resolve against the working directory.
+func (s ExecSpec) targetPath(p string) string {
+	if s.DebugContainer != "" && !strings.HasPrefix(s.TargetRoot, "NSENTER:") && strings.HasPrefix(p, "/") {
+		return strings.TrimSuffix(s.TargetRoot, "/") + p
+	}
+	return p
+}
+
+// StatPath checks that p exists and is readable and reports whether it is a
+// directory.
+func StatPath(ctx context.Context, b Backend, spec ExecSpec, p string) (RemotePath, error) {
+	spec = spec.fileSpec()
+	cmdline := fmt.Sprintf(`p=%s; n=%s; if [ ! -e "$p" ]; then echo "$n: no such file or directory" >&2; exit 1; `+
+		`elif [ ! -r "$p" ]; then echo "$n: permission denied" >&2; exit 1; `+
+		`elif [ -d "$p" ]; then echo dir; else echo file; wc -c < "$p"; fi`, ShellQuote(spec.targetPath(p)), ShellQuote(p))
+	stdout, stderr, err := Exec(ctx, b, spec, cmdline)
+	if err != nil {
+		return RemotePath{}, execError(stderr, err)
+	}
+
+	fields := strings.Fields(stdout)
+	if len(fields) == 0 {
+		return RemotePath{}, fmt.Errorf("%s: unexpected output from stat", p)
+	}
+	info := RemotePath{Path: p, Dir: fields[len(fields)-1] == "dir", Size: -1}
+	if !info.Dir && len(fields) >= 2 {
+		info.Size, _ = strconv.ParseInt(fields[len(fields)-1], 10, 64)
+	}
+	return info, nil
+}
+
+// Download streams a file to w, or a directory as a tar archive of its
+// contents.
+func Download(ctx context.Context, b Backend, spec ExecSpec, info RemotePath, w io.Writer) error {
+	spec = spec.fileSpec()
+	q := ShellQuote(spec.targetPath(info.Path))
+	cmdline := "cat " + q
+	if info.Dir {
+		cmdline = fmt.Sprintf("tar cf - -C %s .", q)
+	}
+	var stderr bytes.Buffer
+	if err := b.Stream(ctx, spec, cmdline, w, &stderr); err != nil {
+		return execError(stderr.String(), err)
+	}
+	return nil
+}
+
+// Upload writes r to remote in the target container. When remote is an
+// existing directory the data is placed inside it as name. With dir set, r
+// is a tar stream (see WriteTar) that is extracted into the destination,
+// which is created if needed. Missing write permission is reported before
+// anything is written.
+func Upload(ctx context.Context, b Backend, spec ExecSpec, remote, name string, dir bool, r io.Reader) error {
+	spec = spec.fileSpec()
+	spec.Stdin = r
+
+	write := `cat > "$d"`
+	if dir {
+		write = `command -v tar >/dev/null || { echo "tar not found in the container; uploading a directory needs tar" >&2; exit 127; }; ` +
+			`mkdir -p "$d" && tar xf - -C "$d"`
+	}
+	cmdline := fmt.Sprintf(`d=%s; n=%s; if [ -d "$d" ]; then d="$d/"%s; n="$n/"%s; fi; `+
+		`case "$d" in */*) p="${d%%/*}";; *) p=.;; esac; [ -n "$p" ] || p=/; `+
+		`[ -d "$p" ] || { echo "$n: no such directory" >&2; exit 1; }; `+
+		`if { [ -e "$d" ] && [ ! -w "$d" ]; } || { [ ! -e "$d" ] && [ ! -w "$p" ]; }; then `+
+		`echo "$n: permission denied (uid $(id -u 2>/dev/null), read-only file system or missing write access)" >&2; exit 13; fi; %s`,
+		ShellQuote(spec.targetPath(remote)), ShellQuote(remote), ShellQuote(name), ShellQuote(name), write)
+
+	var stderr bytes.Buffer
+	if err := b.Stream(ctx, spec, cmdline, io.Discard, &stderr); err != nil {
+		return execError(stderr.String(), err)
+	}
+	return nil
+}
+
+// WriteTar writes the contents of the local directory root to w as a tar
+// archive with paths relative to root.
+func WriteTar(w io.Writer, root string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// maxCompletions caps how many paths Completions returns.
+const maxCompletions = 200
+
+// Completions lists the entries in dir whose names start with prefix.
+// Directories get a trailing slash. dir is relative to the working directory
+// unless absolute, and may be empty.
+func Completions(ctx context.Context, b Backend, spec ExecSpec, dir, prefix string) ([]string, error) {
+	spec = spec.fileSpec()
+	pattern := ShellQuote(spec.targetPath(dir) + prefix)
+	if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		if spec.DebugContainer != "" {
+			// Under the target's root, home is taken to be /, as in cd.
+			pattern = ShellQuote(spec.targetPath("/"+rest) + prefix)
+		} else {
+			// The shell only expands a ~ that is followed by an unquoted /.
+			pattern = "~/" + ShellQuote(rest+prefix)
+		}
+	}
+	cmdline := fmt.Sprintf(`for f in %s*; do [ -e "$f" ] || continue; if [ -d "$f" ]; then echo "${f##*/}/"; else echo "${f##*/}"; fi; done 2>/dev/null | head -n %d`,
+		pattern, maxCompletions)
+	stdout, stderr, err := Exec(ctx, b, spec, cmdline)
+	if err != nil {
+		return nil, execError(stderr, err)
+	}
+	var names []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
@@ -1,6 +1,21 @@
 package tui
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -12,61 +27,493 @@ import (
 func loadStep(s types.Step, m *Model) tea.Cmd {
 	return func() tea.Msg {
 		var vals []string
+		var def string
+		var pods []types.PodInfo
+		var containers []types.ContainerInfo
 		var err error
 
 		switch s {
+		case types.StepPickContext:
+			vals, def, err = m.Backend.GetContexts()
 		case types.StepPickNS:
-			vals, err = kubectl.GetNamespaces()
+			vals, err = m.Backend.GetNamespaces()
 		case types.StepPickType:
 			for _, t := range m.TypeList {
 				vals = append(vals, string(t))
 			}
 		case types.StepPickOwnerOrPod:
 			if m.Rtype == types.RtPod {
-				vals, err = kubectl.GetNamesInNS(m.Namespace, types.RtPod)
+				pods, err = m.Backend.GetPods(m.Namespace)
+				for _, p := range pods {
+					vals = append(vals, p.Name)
+				}
 			} else {
-				vals, err = kubectl.GetNamesInNS(m.Namespace, m.Rtype)
+				vals, err = m.Backend.GetNamesInNS(m.Namespace, m.Rtype)
 			}
 		case types.StepPickPodFromOwner:
-			selector, e := kubectl.GetSelectorForWorkload(m.Namespace, m.Rtype, m.OwnerName)
-			if e != nil {
-				err = e
-				break
+			pods, err = m.Backend.GetPodsForWorkload(m.Namespace, m.Rtype, m.OwnerName)
+			for _, p := range pods {
+				vals = append(vals, p.Name)
 			}
-			vals, err = kubectl.GetPodsBySelector(m.Namespace, selector)
 		case types.StepPickContainer:
-			vals, err = kubectl.GetContainers(m.Namespace, m.PodName)
+			containers, err = m.Backend.GetContainers(m.Namespace, m.PodName)
+			for _, c := range containers {
+				vals = append(vals, c.Name)
+			}
 		default:
 			err = nil
 		}
-		return LoadMsg{Step: s, Err: err, Values: vals}
+		return LoadMsg{Step: s, Err: err, Values: vals, Default: def, Pods: pods, Containers: containers}
+	}
+}
+
+// runCommand starts cmdline and streams its output back as CmdOutputMsg
+// values, followed by a final CmdResultMsg. Each message carries the stream
+// so Update can wait for the next one.
+//
+// When ctx is cancelled or times out the exec stream is closed and the
+// remote process is killed through spec.PIDFile before the result is
+// reported.
+func runCommand(ctx context.Context, backend kubectl.Backend, spec kubectl.ExecSpec, cmdline string) tea.Cmd {
+	return func() tea.Msg {
+		stream := make(chan tea.Msg, 64)
+		go func() {
+			start := time.Now()
+			var stderrBuf strings.Builder
+			stdout := &lineWriter{stream: stream}
+			stderr := &lineWriter{stream: stream, stderr: true, copy: &stderrBuf}
+			err := backend.Stream(ctx, spec, cmdline, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+			if ctx.Err() != nil {
+				_ = kubectl.Kill(backend, spec)
+			}
+			stream <- CmdResultMsg{
+				Cmd: cmdline, Stderr: stderrBuf.String(), Err: err, Took: time.Since(start),
+				Cancelled: errors.Is(ctx.Err(), context.Canceled),
+				TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+			}
+			close(stream)
+		}()
+		return waitForStream(stream)()
+	}
+}
+
+// runBroadcast runs cmdline on every spec concurrently. Each pod's output is
+// buffered and sent as one BroadcastMsg when that pod finishes, so output
+// stays grouped per pod. For /diff (diff set) only the final message is
+// sent. Results are labelled by container when all specs share a pod.
+func runBroadcast(ctx context.Context, backend kubectl.Backend, specs []kubectl.ExecSpec, cmdline string, diff bool) tea.Cmd {
+	return func() tea.Msg {
+		stream := make(chan tea.Msg, len(specs)+1)
+		go func() {
+			start := time.Now()
+			results := make([]PodResult, len(specs))
+			var wg sync.WaitGroup
+			for i, spec := range specs {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var stdout, stderr strings.Builder
+					err := backend.Stream(ctx, spec, cmdline, &stdout, &stderr)
+					if ctx.Err() != nil {
+						_ = kubectl.Kill(backend, spec)
+					}
+					target := spec.Pod
+					if specs[0].Pod == specs[len(specs)-1].Pod && len(specs) > 1 {
+						target = spec.Container
+					}
+					results[i] = PodResult{Target: target, Stdout: stdout.String(), Stderr: stderr.String(), Err: err}
+					if !diff {
+						stream <- BroadcastMsg{Cmd: cmdline, Result: results[i], stream: stream}
+					}
+				}()
+			}
+			wg.Wait()
+			stream <- BroadcastMsg{
+				Cmd: cmdline, Done: true, Diff: diff, Results: results, Took: time.Since(start),
+				Cancelled: errors.Is(ctx.Err(), context.Canceled),
+				TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+			}
+			close(stream)
+		}()
+		return waitForStream(stream)()
 	}
 }
 
-func runCommand(ns, pod, container, cmdline, currentDir string, useDebug bool, debugContainer, targetRoot string) tea.Cmd {
+func waitForStream(stream <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-stream
+		if !ok {
+			return nil
+		}
+		return msg
+	}
+}
+
+// lineWriter forwards complete lines to the stream as CmdOutputMsg values
+// and holds back a trailing partial line until more output or Flush.
+type lineWriter struct {
+	stream  chan tea.Msg
+	stderr  bool
+	copy    *strings.Builder
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if w.copy != nil {
+		w.copy.Write(p)
+	}
+	w.partial = append(w.partial, p...)
+	if i := bytes.LastIndexByte(w.partial, '\n'); i >= 0 {
+		w.stream <- CmdOutputMsg{Text: string(w.partial[:i]), Stderr: w.stderr, stream: w.stream}
+		w.partial = append(w.partial[:0], w.partial[i+1:]...)
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.stream <- CmdOutputMsg{Text: string(w.partial), Stderr: w.stderr, stream: w.stream}
+		w.partial = nil
+	}
+}
+
+// changeDirCmd validates a cd in the container and resolves the new
+// directory to an absolute path.
+func changeDirCmd(ctx context.Context, backend kubectl.Backend, specs []kubectl.ExecSpec, cmdline, arg string) tea.Cmd {
 	return func() tea.Msg {
 		start := time.Now()
-		var stdout, stderr string
-		var err error
+		// In broadcast mode the directory must exist on every pod, since
+		// the same path is used for all of them.
+		dirs := make([]string, len(specs))
+		errs := make([]error, len(specs))
+		var wg sync.WaitGroup
+		for i, spec := range specs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				dirs[i], errs[i] = kubectl.ResolveDir(ctx, backend, spec, arg)
+			}()
+		}
+		wg.Wait()
+
+		res := CdMsg{
+			Cmd: cmdline, Took: time.Since(start),
+			Cancelled: errors.Is(ctx.Err(), context.Canceled),
+			TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+		}
+		if len(specs) == 1 {
+			res.Dir, res.Err = dirs[0], errs[0]
+			return res
+		}
+		var failed []string
+		var first error
+		for i, err := range errs {
+			if err != nil {
+				failed = append(failed, specs[i].Pod)
+				first = cmp.Or(first, err)
+			}
+		}
+		if first != nil {
+			res.Err = fmt.Errorf("%w (%d/%d pods: %s)", first, len(failed), len(specs), strings.Join(failed, ", "))
+			return res
+		}
+		res.Dir = dirs[0]
+		return res
+	}
+}
+
+// downloadCmd copies remote to local, streaming TransferMsg progress. A
+// directory is saved as a tar archive of its contents. The data goes to a
+// temporary file next to local that replaces it only once complete, and an
+// existing file is only replaced when force is set.
+func downloadCmd(ctx context.Context, backend kubectl.Backend, spec kubectl.ExecSpec, cmdline, remote, local string, force bool) tea.Cmd {
+	return transfer(ctx, cmdline, func(progress *progressWriter) TransferMsg {
+		res := TransferMsg{From: remote}
+		info, err := kubectl.StatPath(ctx, backend, spec, remote)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		progress.total = max(info.Size, 0)
+
+		name := path.Base(remote)
+		if name == "." || name == "/" || name == ".." {
+			name = "kcmd-get"
+		}
+		if info.Dir {
+			name += ".tar"
+		}
+		if local == "" {
+			local = name
+		} else if st, err := os.Stat(local); err == nil && st.IsDir() {
+			local = filepath.Join(local, name)
+		}
+		res.To = local
+
+		mode := fs.FileMode(0o644)
+		if st, err := os.Stat(local); err == nil {
+			if !force {
+				res.Err = fmt.Errorf("%s already exists (/get -f overwrites it)", local)
+				return res
+			}
+			if !st.Mode().IsRegular() {
+				res.Err = fmt.Errorf("%s is not a regular file", local)
+				return res
+			}
+			mode = st.Mode().Perm()
+		}
+
+		f, err := os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+".kcmd-*")
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		h := sha256.New()
+		err = kubectl.Download(ctx, backend, spec, info, io.MultiWriter(f, h, progress))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Chmod(f.Name(), mode)
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), local)
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			res.Err = err
+			return res
+		}
+		res.Sum = hex.EncodeToString(h.Sum(nil))
+		return res
+	})
+}
+
+// uploadCmd copies the local file or directory into remote, streaming
+// TransferMsg progress. Directories are sent as a tar stream.
+func uploadCmd(ctx context.Context, backend kubectl.Backend, spec kubectl.ExecSpec, cmdline, local, remote string) tea.Cmd {
+	return transfer(ctx, cmdline, func(progress *progressWriter) TransferMsg {
+		res := TransferMsg{From: local, To: remote}
+		st, err := os.Stat(local)
+		if err != nil {
+			res.Err = err
+			return res
+		}
 
-		if useDebug {
-			stdout, stderr, err = kubectl.ExecInDebugContainer(ns, pod, debugContainer, targetRoot, cmdline, currentDir)
+		var src io.Reader
+		if st.IsDir() {
+			err = filepath.WalkDir(local, func(_ string, d fs.DirEntry, err error) error {
+				if err == nil && d.Type().IsRegular() {
+					if info, ierr := d.Info(); ierr == nil {
+						progress.total += info.Size()
+					}
+				}
+				return err
+			})
+			if err != nil {
+				res.Err = err
+				return res
+			}
+			pr, pw := io.Pipe()
+			go func() { pw.CloseWithError(kubectl.WriteTar(pw, local)) }()
+			defer pr.Close()
+			src = pr
 		} else {
-			stdout, stderr, err = kubectl.ExecInPod(ns, pod, container, cmdline, currentDir)
+			f, err := os.Open(local)
+			if err != nil {
+				res.Err = err
+				return res
+			}
+			defer f.Close()
+			progress.total = st.Size()
+			src = f
+		}
+
+		h := sha256.New()
+		r := io.TeeReader(src, io.MultiWriter(h, progress))
+		name := filepath.Base(filepath.Clean(local))
+		if err := kubectl.Upload(ctx, backend, spec, remote, name, st.IsDir(), r); err != nil {
+			res.Err = err
+			return res
 		}
+		res.Sum = hex.EncodeToString(h.Sum(nil))
+		return res
+	})
+}
 
-		return CmdResultMsg{
-			Cmd: cmdline, Stdout: stdout, Stderr: stderr, Err: err, Took: time.Since(start),
+// fetchForEdit downloads remote into a temporary file for /edit.
+func fetchForEdit(ctx context.Context, backend kubectl.Backend, spec kubectl.ExecSpec, cmdline, remote string) tea.Cmd {
+	return editStep(ctx, func() EditMsg {
+		res := EditMsg{Cmd: cmdline, Remote: remote}
+		info, err := kubectl.StatPath(ctx, backend, spec, remote)
+		if err == nil && info.Dir {
+			err = fmt.Errorf("%s: is a directory", remote)
+		}
+		if err != nil {
+			res.Err = err
+			return res
 		}
+
+		f, err := os.CreateTemp("", "kcmd-*-"+path.Base(remote))
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.Local = f.Name()
+		h := sha256.New()
+		err = kubectl.Download(ctx, backend, spec, info, io.MultiWriter(f, h))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(res.Local)
+			res.Err = err
+			return res
+		}
+		res.Sum = hex.EncodeToString(h.Sum(nil))
+		return res
+	})
+}
+
+// openEditor suspends the program and opens the fetched file in $VISUAL or
+// $EDITOR, falling back to vi.
+func openEditor(msg EditMsg) tea.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
 	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := append(strings.Fields(editor), msg.Local)
+	c := exec.Command(args[0], args[1:]...)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		msg.Edited = true
+		msg.Err = err
+		return msg
+	})
 }
 
-func createDebugContainerCmd(ns, pod, container string) tea.Cmd {
+// saveEdit writes the edited file back unless the remote file changed since
+// it was fetched, in which case the local copy is kept.
+func saveEdit(ctx context.Context, backend kubectl.Backend, spec kubectl.ExecSpec, msg EditMsg) tea.Cmd {
+	return editStep(ctx, func() EditMsg {
+		msg.Saved = true
+		data, err := os.ReadFile(msg.Local)
+		if err != nil {
+			msg.Err = err
+			return msg
+		}
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) == msg.Sum {
+			msg.Unchanged = true
+			os.Remove(msg.Local)
+			return msg
+		}
+
+		info, err := kubectl.StatPath(ctx, backend, spec, msg.Remote)
+		if err != nil {
+			msg.Err = err
+			return msg
+		}
+		h := sha256.New()
+		if err := kubectl.Download(ctx, backend, spec, info, h); err != nil {
+			msg.Err = err
+			return msg
+		}
+		if hex.EncodeToString(h.Sum(nil)) != msg.Sum {
+			msg.Changed = true
+			return msg
+		}
+
+		if err := kubectl.Upload(ctx, backend, spec, msg.Remote, path.Base(msg.Remote), false, bytes.NewReader(data)); err != nil {
+			msg.Err = err
+			return msg
+		}
+		os.Remove(msg.Local)
+		return msg
+	})
+}
+
+// editStep runs one stage of /edit and marks a failure as cancelled or timed
+// out when ctx ended it.
+func editStep(ctx context.Context, fn func() EditMsg) tea.Cmd {
+	return func() tea.Msg {
+		msg := fn()
+		if msg.Err != nil {
+			msg.Cancelled = errors.Is(ctx.Err(), context.Canceled)
+			msg.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+		}
+		return msg
+	}
+}
+
+// transfer runs fn in the background and streams its progress followed by
+// the final TransferMsg.
+func transfer(ctx context.Context, cmdline string, fn func(*progressWriter) TransferMsg) tea.Cmd {
+	return func() tea.Msg {
+		stream := make(chan tea.Msg, 16)
+		go func() {
+			start := time.Now()
+			progress := &progressWriter{stream: stream, cmd: cmdline, last: start}
+			res := fn(progress)
+			res.Cmd = cmdline
+			res.Bytes = progress.n
+			res.Total = progress.total
+			res.Done = true
+			res.Took = time.Since(start)
+			res.Cancelled = errors.Is(ctx.Err(), context.Canceled)
+			res.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+			stream <- res
+			close(stream)
+		}()
+		return waitForStream(stream)()
+	}
+}
+
+const progressInterval = 200 * time.Millisecond
+
+// progressWriter counts bytes passing through a transfer and sends a
+// TransferMsg at most every progressInterval.
+type progressWriter struct {
+	stream chan tea.Msg
+	cmd    string
+	n      int64
+	total  int64
+	last   time.Time
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	if time.Since(w.last) >= progressInterval {
+		w.last = time.Now()
+		w.stream <- TransferMsg{Cmd: w.cmd, Bytes: w.n, Total: w.total, stream: w.stream}
+	}
+	return len(p), nil
+}
+
+func createDebugContainerCmd(backend kubectl.Backend, ns, pod, container string, profile kubectl.DebugProfile) tea.Cmd {
 	return func() tea.Msg {
-		debugName, targetRoot, err := kubectl.CreateDebugContainer(ns, pod, container)
+		// Ephemeral containers cannot be removed, so attach to a running one
+		// rather than adding another on every reconnect.
+		existing, running, err := backend.FindDebugContainer(ns, pod, container, profile)
+		if err != nil {
+			return DebugContainerMsg{Err: fmt.Errorf("looking for an existing debug container: %w", err)}
+		}
+		if running {
+			return DebugContainerMsg{
+				DebugContainer: existing,
+				TargetRoot:     kubectl.DebugTargetRoot(backend, ns, pod, existing),
+				Reused:         true,
+			}
+		}
+
+		debugName, targetRoot, err := backend.CreateDebugContainer(ns, pod, container, profile)
 		return DebugContainerMsg{
 			DebugContainer: debugName,
 			TargetRoot:     targetRoot,
+			Exited:         existing,
 			Err:            err,
 		}
 	}
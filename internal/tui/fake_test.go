@@ -0,0 +1,87 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"kui/internal/kubectl"
+	"kui/internal/types"
+)
+
+// fakeBackend serves canned cluster data. Stream writes Output to stdout, or
+// calls Handler when it is set.
+type fakeBackend struct {
+	Contexts   []string
+	Current    string
+	Namespaces []string
+	Workloads  map[types.ResType][]string
+	Pods       []types.PodInfo
+	Containers []types.ContainerInfo
+	Output     string
+	Handler    func(spec kubectl.ExecSpec, cmdline string, stdout io.Writer) error
+
+	mu sync.Mutex
+
+	UsedContext string
+	Commands    []string
+	Specs       []kubectl.ExecSpec
+}
+
+var _ kubectl.Backend = (*fakeBackend)(nil)
+
+func (f *fakeBackend) GetContexts() ([]string, string, error) {
+	return f.Contexts, f.Current, nil
+}
+
+func (f *fakeBackend) UseContext(name string) error {
+	f.UsedContext = name
+	return nil
+}
+
+func (f *fakeBackend) GetNamespaces() ([]string, error) { return f.Namespaces, nil }
+
+func (f *fakeBackend) GetNamesInNS(namespace string, kind types.ResType) ([]string, error) {
+	return f.Workloads[kind], nil
+}
+
+func (f *fakeBackend) GetPods(namespace string) ([]types.PodInfo, error) { return f.Pods, nil }
+
+func (f *fakeBackend) GetPodsForWorkload(namespace string, kind types.ResType, name string) ([]types.PodInfo, error) {
+	return f.Pods, nil
+}
+
+func (f *fakeBackend) GetContainers(namespace, pod string) ([]types.ContainerInfo, error) {
+	return f.Containers, nil
+}
+
+func (f *fakeBackend) GetPodSecurityPolicy(namespace string) (string, error) { return "", nil }
+
+func (f *fakeBackend) SetPodSecurityPolicy(namespace, policy string) error { return nil }
+
+func (f *fakeBackend) CreateDebugContainer(namespace, pod, targetContainer string, profile kubectl.DebugProfile) (string, string, error) {
+	return "", "", errors.New("not supported by the fake")
+}
+
+func (f *fakeBackend) FindDebugContainer(namespace, pod, targetContainer string, profile kubectl.DebugProfile) (string, bool, error) {
+	return "", false, nil
+}
+
+func (f *fakeBackend) WaitForDebugContainerReady(namespace, pod, debugContainer string) error {
+	return nil
+}
+
+func (f *fakeBackend) DeletePod(namespace, pod string) error { return nil }
+
+func (f *fakeBackend) Stream(ctx context.Context, spec kubectl.ExecSpec, cmdline string, stdout, stderr io.Writer) error {
+	f.mu.Lock()
+	f.Commands = append(f.Commands, cmdline)
+	f.Specs = append(f.Specs, spec)
+	f.mu.Unlock()
+	if f.Handler != nil {
+		return f.Handler(spec, cmdline, stdout)
+	}
+	_, err := io.WriteString(stdout, f.Output)
+	return err
+}
@@ -1,24 +1,574 @@
 package tui
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sahilm/fuzzy"
 
+	"kui/internal/diff"
+	"kui/internal/history"
+	"kui/internal/journal"
+	"kui/internal/kubectl"
 	"kui/internal/types"
 )
 
 func (m *Model) SetList(title string, values []string) {
-	items := make([]list.Item, 0, len(values))
+	items := make([]types.ListItem, 0, len(values))
 	for _, v := range values {
 		items = append(items, types.NewListItem(v, ""))
 	}
-	m.Lst.SetItems(items)
+	m.SetItems(title, items)
+}
+
+// SetItems replaces the list content. Descriptions are only rendered when at
+// least one item has one.
+func (m *Model) SetItems(title string, items []types.ListItem) {
+	listItems := make([]list.Item, 0, len(items))
+	showDescription := false
+	for _, it := range items {
+		listItems = append(listItems, it)
+		showDescription = showDescription || it.Description() != ""
+	}
+	m.Lst.SetDelegate(newDelegate(showDescription))
+	m.Lst.SetItems(listItems)
 	m.Lst.Title = title
 	m.Lst.ResetSelected()
 }
 
+// allPodsChoice is the pod step's item for broadcasting to every pod.
+const allPodsChoice = "* alle pods"
+
+// showPods fills the list with m.Pods, each described by its status,
+// readiness, restarts, age and node. A Deployment's pods are grouped by
+// ReplicaSet revision, newest first, when GroupByRevision is on.
+func (m *Model) showPods() {
+	pods := slices.Clone(m.Pods)
+	grouped := m.GroupByRevision && m.Rtype == types.RtDeployment
+	newest := 0
+	if grouped {
+		sort.SliceStable(pods, func(i, j int) bool { return pods[i].Revision > pods[j].Revision })
+		if len(pods) > 0 {
+			newest = pods[0].Revision
+		}
+	}
+
+	items := make([]types.ListItem, 0, len(pods)+1)
+	if m.Step == types.StepPickPodFromOwner && len(pods) > 1 {
+		items = append(items, types.NewListItem(allPodsChoice, fmt.Sprintf("kjør hver kommando på alle %d pods samtidig", len(pods))))
+	}
+	for _, p := range pods {
+		desc := podDescription(p)
+		if grouped {
+			age := "gammel"
+			if p.Revision == newest {
+				age = "nyeste"
+			}
+			desc = fmt.Sprintf("rev %d · %s · %s  %s", p.Revision, p.ReplicaSet, age, desc)
+		}
+		items = append(items, types.NewListItem(p.Name, desc))
+	}
+
+	title := "Velg pod"
+	if grouped {
+		title = "Velg pod (gruppert etter revisjon)"
+	}
+	m.SetItems(title, items)
+}
+
+// showContainers fills the list with m.Containers labelled by kind and
+// state. Containers that are not running are dimmed and cannot be chosen.
+func (m *Model) showContainers() {
+	items := make([]types.ListItem, 0, len(m.Containers))
+	for _, c := range m.Containers {
+		desc := fmt.Sprintf("[%s] %s", c.Kind, c.State)
+		if c.Running {
+			desc = fmt.Sprintf("[%s] %s", c.Kind, OkStyle.Render("● "+c.State))
+		} else {
+			desc = HelpStyle.Render(desc)
+		}
+		items = append(items, types.NewListItem(c.Name, desc))
+	}
+	m.SetItems("Velg container", items)
+}
+
+func podDescription(p types.PodInfo) string {
+	var status string
+	switch {
+	case p.Healthy():
+		status = OkStyle.Render("● " + p.Status)
+	case p.Status == "Completed" || p.Status == "Succeeded":
+		status = HelpStyle.Render("○ " + p.Status)
+	case p.Status == "Pending" || p.Status == "ContainerCreating" || p.Status == "Running":
+		status = WarnStyle.Render("◐ " + p.Status)
+	default:
+		status = ErrStyle.Render("✗ " + p.Status)
+	}
+
+	desc := fmt.Sprintf("%s  %d/%d ready  %d restarts  %s", status, p.Ready, p.Total, p.Restarts, formatAge(time.Since(p.Created)))
+	if p.Node != "" {
+		desc += "  " + p.Node
+	}
+	return desc
+}
+
+// formatAge renders a duration the way kubectl's AGE column does.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// localPath expands a leading ~/ to the user's home directory.
+func localPath(p string) string {
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return p
+}
+
+// SelectValue moves the list cursor to the item titled v, if present.
+func (m *Model) SelectValue(v string) {
+	for i, it := range m.Lst.Items() {
+		if li, ok := it.(types.ListItem); ok && li.Title() == v {
+			m.Lst.Select(i)
+			return
+		}
+	}
+}
+
+// execSpec describes where shell commands currently run: the selected
+// container, or the debug container once one has been attached.
+func (m *Model) execSpec() kubectl.ExecSpec {
+	spec := kubectl.ExecSpec{
+		Namespace:  m.Namespace,
+		Pod:        m.PodName,
+		Container:  m.Container,
+		CurrentDir: m.CurrentDir,
+		Env:        m.Env,
+	}
+	if m.UseDebugContainer {
+		spec.DebugContainer = m.DebugContainer
+		spec.TargetRoot = m.TargetRoot
+	}
+	return spec
+}
+
+// maxPopupLines is the height of the completion popup.
+const maxPopupLines = 8
+
+// completionTimeout bounds the exec that lists completion candidates.
+const completionTimeout = 5 * time.Second
+
+func (m *Model) popupLines() int {
+	return min(len(m.Completions), maxPopupLines)
+}
+
+// resizeShell fits the viewport to the window, leaving room for the
+// completion popup when it is open.
+func (m *Model) resizeShell() {
+	if m.Width == 0 || m.Height == 0 {
+		return
+	}
+	m.Vp.Width = m.Width - 2
+	m.Vp.Height = max(m.Height-3-m.popupLines(), 1)
+	m.Input.Width = m.Width - 2
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// debugProfile returns the selected debug profile.
+func (m *Model) debugProfile() kubectl.DebugProfile {
+	p, _ := kubectl.FindDebugProfile(m.DebugProfiles, m.DebugProfile)
+	return p
+}
+
+// containerGone reports whether exec failed because the container has
+// stopped.
+func containerGone(stderr string) bool {
+	return strings.Contains(stderr, "container not found") ||
+		strings.Contains(stderr, "not created or running") ||
+		strings.Contains(stderr, "container is not running")
+}
+
+// retarget starts the wizard over, keeping the session settings.
+func (m *Model) retarget() *Model {
+	n := InitialModel(m.Backend)
+	n.Timeout = m.Timeout
+	n.DebugProfiles = m.DebugProfiles
+	n.DebugProfile = m.DebugProfile
+	n.Journal = m.Journal
+	n.Kubeconfig = m.Kubeconfig
+	return n
+}
+
+// setPodSecurityPolicy changes the namespace's enforce label from original
+// to policy. The change is journaled first, so that it can be rolled back
+// even if kcmd never gets to restore it.
+func (m *Model) setPodSecurityPolicy(original, policy string) error {
+	kubeContext := m.Context
+	if kubeContext == "" {
+		if _, current, err := m.Backend.GetContexts(); err == nil {
+			kubeContext = current
+		}
+	}
+	e, err := m.Journal.Record(journal.Entry{
+		Kubeconfig: m.Kubeconfig,
+		Context:    kubeContext,
+		Namespace:  m.Namespace,
+		Original:   original,
+		Applied:    policy,
+	})
+	if err != nil {
+		return fmt.Errorf("could not write PodSecurity journal: %w", err)
+	}
+	if err := m.Backend.SetPodSecurityPolicy(m.Namespace, policy); err != nil {
+		_ = m.Journal.Done(e.ID)
+		return err
+	}
+	return nil
+}
+
+// loadHistory switches to the persisted history of the current target.
+func (m *Model) loadHistory() {
+	kind, name := string(m.Rtype), m.OwnerName
+	if m.Rtype == types.RtPod || name == "" {
+		kind, name = string(types.RtPod), m.PodName
+	}
+	m.HistoryKey = history.Key(m.Context, m.Namespace, kind, name)
+	m.History, _ = m.HistoryStore.Load(m.HistoryKey)
+	m.HistIdx = -1
+}
+
+// addHistory records cmdline unless it repeats the previous command.
+func (m *Model) addHistory(cmdline string) {
+	if len(m.History) > 0 && m.History[len(m.History)-1] == cmdline {
+		return
+	}
+	m.History = append(m.History, cmdline)
+	if err := m.HistoryStore.Append(m.HistoryKey, cmdline); err != nil {
+		m.LastErr = fmt.Sprintf("kunne ikke lagre historikk: %v", err)
+	}
+}
+
+// startSearch enters reverse-i-search over this target's history and the
+// global history, most recent first.
+func (m *Model) startSearch() {
+	global, _ := m.HistoryStore.Global()
+	seen := map[string]bool{}
+	m.SearchCandidates = nil
+	for _, hist := range [][]string{m.History, global} {
+		for i := len(hist) - 1; i >= 0; i-- {
+			if !seen[hist[i]] {
+				seen[hist[i]] = true
+				m.SearchCandidates = append(m.SearchCandidates, hist[i])
+			}
+		}
+	}
+	m.Searching = true
+	m.SearchQuery = ""
+	m.updateSearch()
+}
+
+// updateSearch ranks the candidates against the query. Fuzzy ranking is
+// stable, so equally good matches stay in recency order.
+func (m *Model) updateSearch() {
+	m.SearchIdx = 0
+	if m.SearchQuery == "" {
+		m.SearchMatches = m.SearchCandidates
+		return
+	}
+	m.SearchMatches = nil
+	for _, match := range fuzzy.Find(m.SearchQuery, m.SearchCandidates) {
+		m.SearchMatches = append(m.SearchMatches, match.Str)
+	}
+}
+
+func (m *Model) searchMatch() string {
+	if m.SearchIdx < len(m.SearchMatches) {
+		return m.SearchMatches[m.SearchIdx]
+	}
+	return ""
+}
+
+// appendPodResult prints one pod's broadcast output, each line prefixed
+// with the pod name.
+func (m *Model) appendPodResult(r PodResult) {
+	prefix := TitleStyle.Render(fmt.Sprintf("[%s]", r.Target))
+	for _, stream := range []struct {
+		text  string
+		style lipgloss.Style
+	}{{r.Stdout, lipgloss.NewStyle()}, {r.Stderr, ErrStyle}} {
+		for _, line := range strings.Split(strings.TrimRight(stream.text, "\n"), "\n") {
+			if line != "" {
+				m.AppendOutput(prefix + " " + stream.style.Render(line))
+			}
+		}
+	}
+}
+
+// appendBroadcastSummary lists the pods that did not exit 0.
+func (m *Model) appendBroadcastSummary(msg BroadcastMsg) {
+	failed := 0
+	for _, r := range msg.Results {
+		switch code := kubectl.ExitCode(r.Err); {
+		case code == 0:
+		case code > 0:
+			failed++
+			m.AppendOutput(ErrStyle.Render(fmt.Sprintf("✗ %s exit %d", r.Target, code)))
+		default:
+			failed++
+			m.AppendOutput(ErrStyle.Render(fmt.Sprintf("✗ %s: %v", r.Target, r.Err)))
+		}
+	}
+	status := OkStyle.Render(fmt.Sprintf("%d/%d OK", len(msg.Results), len(msg.Results)))
+	if failed > 0 {
+		status = ErrStyle.Render(fmt.Sprintf("%d/%d OK", len(msg.Results)-failed, len(msg.Results)))
+		m.LastErr = fmt.Sprintf("%d av %d pods feilet", failed, len(msg.Results))
+	}
+	m.AppendOutput(summary(msg.Cmd, msg.Took, status))
+}
+
+// diffSpecs picks what /diff compares: the workload's running pods, or the
+// pod's running containers when there is only one pod. The debug container
+// is not used, so the containers need a shell.
+func (m *Model) diffSpecs() ([]kubectl.ExecSpec, error) {
+	base := m.execSpec()
+	base.DebugContainer, base.TargetRoot = "", ""
+
+	var specs []kubectl.ExecSpec
+	if m.Rtype != types.RtPod {
+		for _, p := range m.Pods {
+			if p.Status == "Running" {
+				spec := base
+				spec.Pod = p.Name
+				specs = append(specs, spec)
+			}
+		}
+	}
+	if len(specs) < 2 {
+		specs = nil
+		for _, c := range m.Containers {
+			if c.Running && c.Kind != types.ContainerEphemeral {
+				spec := base
+				spec.Container = c.Name
+				specs = append(specs, spec)
+			}
+		}
+	}
+	if len(specs) < 2 {
+		return nil, errors.New("/diff needs at least two running pods or containers")
+	}
+	return specs, nil
+}
+
+// appendDiff shows how each target's output differs from the first one's.
+// Stdout and stderr are compared together.
+func (m *Model) appendDiff(msg BroadcastMsg) {
+	for _, r := range msg.Results {
+		if code := kubectl.ExitCode(r.Err); code != 0 {
+			m.AppendOutput(WarnStyle.Render(fmt.Sprintf("! %s exit %d", r.Target, code)))
+		}
+	}
+
+	base := msg.Results[0]
+	baseLines := diff.SplitLines(base.Stdout + base.Stderr)
+	same := []string{base.Target}
+	differ := 0
+	for _, r := range msg.Results[1:] {
+		hunks := diff.Unified(baseLines, diff.SplitLines(r.Stdout+r.Stderr), 3)
+		if len(hunks) == 0 {
+			same = append(same, r.Target)
+			continue
+		}
+		differ++
+		m.AppendOutput(ErrStyle.Render("--- " + base.Target))
+		m.AppendOutput(OkStyle.Render("+++ " + r.Target))
+		for _, line := range hunks {
+			switch line[0] {
+			case '@':
+				m.AppendOutput(HelpStyle.Render(line))
+			case '-':
+				m.AppendOutput(ErrStyle.Render(line))
+			case '+':
+				m.AppendOutput(OkStyle.Render(line))
+			default:
+				m.AppendOutput(line)
+			}
+		}
+	}
+	m.AppendOutput(fmt.Sprintf("= identical: %s", strings.Join(same, ", ")))
+
+	status := OkStyle.Render("IDENTICAL")
+	if differ > 0 {
+		status = WarnStyle.Render(fmt.Sprintf("%d/%d DIFFER", differ, len(msg.Results)-1))
+	}
+	m.AppendOutput(summary("/diff "+msg.Cmd, msg.Took, status))
+}
+
+// podSpecs returns the exec spec for every pod in broadcast mode.
+func (m *Model) podSpecs() []kubectl.ExecSpec {
+	specs := make([]kubectl.ExecSpec, 0, len(m.BroadcastPods))
+	for _, pod := range m.BroadcastPods {
+		spec := m.execSpec()
+		spec.Pod = pod
+		spec.PIDFile = m.PIDFile
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// startCommand echoes cmdline to the output and starts streaming it.
+func (m *Model) startCommand(cmdline string) tea.Cmd {
+	ctx := m.begin(cmdline)
+	if m.Broadcast {
+		return tea.Batch(m.Spin.Tick, runBroadcast(ctx, m.Backend, m.podSpecs(), cmdline, false))
+	}
+	spec := m.execSpec()
+	spec.PIDFile = m.PIDFile
+	return tea.Batch(m.Spin.Tick, runCommand(ctx, m.Backend, spec, cmdline))
+}
+
+// begin echoes cmdline and marks it as running. The returned context is
+// cancelled by ctrl+c and, unless timeoutFor exempts cmdline, bounded by the
+// per-command timeout.
+func (m *Model) begin(cmdline string) context.Context {
+	m.AppendOutput(fmt.Sprintf("» %s", cmdline))
+	return m.track(cmdline)
+}
+
+// track marks label as running without echoing it. Each command gets its
+// own pid file, so a late kill cannot hit the one that follows.
+func (m *Model) track(label string) context.Context {
+	m.Loading = true
+	m.Running = label
+	m.RunStart = time.Now()
+	m.PIDFile = fmt.Sprintf("/tmp/kcmd-%d.pid", m.RunStart.UnixNano())
+	m.Transferred, m.TransferTotal = 0, 0
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout := m.timeoutFor(label); timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	m.CancelRun = cancel
+	return ctx
+}
+
+// timeoutFor returns the timeout for cmdline. Transfers and commands that
+// follow output until stopped are not bounded; ctrl+c still cancels them.
+func (m *Model) timeoutFor(cmdline string) time.Duration {
+	switch word, _, _ := strings.Cut(cmdline, " "); word {
+	case "/get", "/put", "/edit":
+		return 0
+	}
+	if followsOutput(cmdline) {
+		return 0
+	}
+	return m.Timeout
+}
+
+// followsOutput reports whether a command in cmdline runs until it is
+// stopped, such as tail -f or watch.
+func followsOutput(cmdline string) bool {
+	segments := strings.FieldsFunc(cmdline, func(r rune) bool { return r == '|' || r == ';' || r == '&' })
+	for _, segment := range segments {
+		words := strings.Fields(segment)
+		// Skip VAR=value assignments in front of the command.
+		for len(words) > 0 && strings.Contains(words[0], "=") {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			continue
+		}
+		args := words[1:]
+		switch path.Base(words[0]) {
+		case "watch", "top":
+			return true
+		case "tail":
+			for _, a := range args {
+				if a == "--follow" || strings.HasPrefix(a, "--follow=") ||
+					(strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--") && strings.ContainsAny(a, "fF")) {
+					return true
+				}
+			}
+		case "journalctl":
+			if slices.Contains(args, "-f") || slices.Contains(args, "--follow") {
+				return true
+			}
+		case "kubectl":
+			if slices.Contains(args, "logs") && (slices.Contains(args, "-f") || slices.Contains(args, "--follow")) {
+				return true
+			}
+		case "ping":
+			if !slices.Contains(args, "-c") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// finish clears the running state set by begin.
+func (m *Model) finish() {
+	m.Loading = false
+	m.Running = ""
+	if m.CancelRun != nil {
+		m.CancelRun()
+		m.CancelRun = nil
+	}
+}
+
+// summary is the line that closes a command's output.
+func summary(cmd string, took time.Duration, status string) string {
+	return fmt.Sprintf("« %s  (%s)  [%s]", cmd, took.Round(time.Millisecond), status)
+}
+
 func (m *Model) AppendOutput(s string) {
 	if s == "" {
 		return
@@ -0,0 +1,49 @@
+package tui
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommonPrefixKeepsRunes(t *testing.T) {
+	if got := commonPrefix([]string{"æble", "ørret"}); got != "" {
+		t.Fatalf("commonPrefix = %q", got)
+	}
+	if got := commonPrefix([]string{"blåbær", "blåskjell"}); got != "blå" {
+		t.Fatalf("commonPrefix = %q", got)
+	}
+}
+
+func TestTimeoutFor(t *testing.T) {
+	m := &Model{Timeout: time.Minute}
+	tests := []struct {
+		cmdline string
+		bounded bool
+	}{
+		{"ls -la", true},
+		{"curl http://api:8080/health", true},
+		{"tail -n 100 app.log", true},
+		{"tail -f app.log", false},
+		{"tail -n100 -F app.log", false},
+		{"cat app.log | tail --follow", false},
+		{"TZ=UTC journalctl -u app -f", false},
+		{"kubectl apply -f deploy.yaml", true},
+		{"kubectl logs -f deploy/api", false},
+		{"watch -n1 date", false},
+		{"ping -c 3 db", true},
+		{"ping db", false},
+		{"/get /var/log/big.log", false},
+		{"/put dump.sql /tmp", false},
+		{"/edit /etc/app.conf", false},
+		{"/diff tail -f app.log", true},
+	}
+	for _, tt := range tests {
+		want := time.Duration(0)
+		if tt.bounded {
+			want = time.Minute
+		}
+		if got := m.timeoutFor(tt.cmdline); got != want {
+			t.Errorf("timeoutFor(%q) = %s, want %s", tt.cmdline, got, want)
+		}
+	}
+}
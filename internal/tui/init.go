@@ -7,5 +7,28 @@ import (
 )
 
 func (m *Model) Init() tea.Cmd {
-	return tea.Batch(m.Spin.Tick, loadStep(types.StepPickNS, m))
+	m.Step = m.firstStep()
+	return tea.Batch(m.Spin.Tick, loadStep(m.Step, m))
+}
+
+// firstStep returns the first wizard step whose selection was not prefilled.
+// The container step is always loaded so that prefilled names are validated
+// before the shell opens.
+func (m *Model) firstStep() types.Step {
+	switch {
+	case m.Namespace == "" && m.Context == "":
+		return types.StepPickContext
+	case m.Namespace == "":
+		return types.StepPickNS
+	case m.Rtype == "":
+		return types.StepPickType
+	case m.Rtype == types.RtPod && m.PodName == "":
+		return types.StepPickOwnerOrPod
+	case m.Rtype != types.RtPod && m.OwnerName == "":
+		return types.StepPickOwnerOrPod
+	case m.PodName == "":
+		return types.StepPickPodFromOwner
+	default:
+		return types.StepPickContainer
+	}
 }
@@ -3,25 +3,115 @@ package tui
 import (
 	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
+
 	"kui/internal/types"
 )
 
 type LoadMsg struct {
-	Step   types.Step
-	Err    error
-	Values []string
+	Step       types.Step
+	Err        error
+	Values     []string
+	Default    string
+	Pods       []types.PodInfo
+	Containers []types.ContainerInfo
 }
 
 type DebugContainerMsg struct {
 	DebugContainer string
 	TargetRoot     string
-	Err            error
+	// Reused is set when an existing debug container was attached to.
+	Reused bool
+	// Exited names the matching debug container that had stopped and was
+	// replaced.
+	Exited string
+	Err    error
 }
 
-type CmdResultMsg struct {
+// CmdOutputMsg carries one or more complete lines of output from a running
+// command.
+type CmdOutputMsg struct {
+	Text   string
+	Stderr bool
+	stream <-chan tea.Msg
+}
+
+// CdMsg reports the directory a cd resolved to in the container.
+type CdMsg struct {
+	Cmd       string
+	Dir       string
+	Err       error
+	Took      time.Duration
+	Cancelled bool
+	TimedOut  bool
+}
+
+// TransferMsg reports progress of a /get or /put. The last message has Done
+// set and carries the outcome.
+type TransferMsg struct {
+	Cmd   string
+	Bytes int64
+	Total int64
+
+	Done      bool
+	From      string
+	To        string
+	Sum       string
+	Err       error
+	Cancelled bool
+	TimedOut  bool
+	Took      time.Duration
+	stream    <-chan tea.Msg
+}
+
+// EditMsg moves an /edit through its stages: fetched into Local, edited
+// (Edited set once the editor exits) and finally Saved back.
+type EditMsg struct {
 	Cmd    string
+	Remote string
+	Local  string
+	// Sum is the sha256 of the remote file when it was fetched.
+	Sum    string
+	Edited bool
+	Saved  bool
+	// Unchanged reports that the file was not modified in the editor;
+	// Changed that the remote file no longer matches Sum.
+	Unchanged bool
+	Changed   bool
+	Err       error
+	Cancelled bool
+	TimedOut  bool
+}
+
+// PodResult is one pod's (or container's) share of a broadcast command.
+type PodResult struct {
+	Target string
 	Stdout string
 	Stderr string
 	Err    error
-	Took   time.Duration
+}
+
+// BroadcastMsg delivers each pod's output as it finishes. The last message
+// has Done set and carries all results.
+type BroadcastMsg struct {
+	Cmd       string
+	Result    PodResult
+	Done      bool
+	Diff      bool
+	Results   []PodResult
+	Took      time.Duration
+	Cancelled bool
+	TimedOut  bool
+	stream    <-chan tea.Msg
+}
+
+// CmdResultMsg is sent when a command finishes. Stderr repeats everything
+// written to stderr so failures can be inspected after streaming.
+type CmdResultMsg struct {
+	Cmd       string
+	Stderr    string
+	Err       error
+	Took      time.Duration
+	Cancelled bool
+	TimedOut  bool
 }
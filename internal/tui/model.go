@@ -1,20 +1,29 @@
 package tui
 
 import (
+	"context"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 
+	"kui/internal/config"
+	"kui/internal/history"
+	"kui/internal/journal"
+	"kui/internal/kubectl"
 	"kui/internal/types"
 )
 
 type Model struct {
+	Backend kubectl.Backend
+
 	Step types.Step
 
 	// selections
+	Context   string
 	Namespace string
 	Rtype     types.ResType
 
@@ -22,6 +31,15 @@ type Model struct {
 	PodName   string
 	Container string
 
+	// AutoPick lets the wizard skip steps whose answer is already known:
+	// values given on the command line, or a single pod/container. It is
+	// turned off when the user navigates back.
+	AutoPick bool
+
+	// GroupByRevision orders a Deployment's pods by ReplicaSet revision,
+	// newest first, so old pods stand out during a rollout.
+	GroupByRevision bool
+
 	// ui components
 	Lst     list.Model
 	Input   textinput.Model
@@ -30,11 +48,14 @@ type Model struct {
 	Loading bool
 
 	// data cache
+	ContextList   []string
 	NsList        []string
 	TypeList      []types.ResType
 	OwnerList     []string
 	PodList       []string
+	Pods          []types.PodInfo
 	ContainerList []string
+	Containers    []types.ContainerInfo
 
 	// repl
 	Output            strings.Builder
@@ -42,33 +63,80 @@ type Model struct {
 	AutocompleteWords map[string]bool
 	History           []string
 	HistIdx           int
+	HistoryStore      *history.Store
+	HistoryKey        string
 	LastErr           string
 	Width             int
 	Height            int
 	CurrentDir        string
+	// PrevDir is where cd - goes; HasPrevDir is false until the first cd,
+	// since an empty PrevDir is the starting directory.
+	PrevDir    string
+	HasPrevDir bool
+	Env        []kubectl.EnvVar
+	Running    string
+	RunStart   time.Time
+	// Transferred and TransferTotal track a running /get or /put; the total
+	// is 0 when unknown.
+	Transferred   int64
+	TransferTotal int64
+	// CancelRun stops the running command; PIDFile is where its remote
+	// shell records its pid so a cancelled command can be killed.
+	CancelRun context.CancelFunc
+	PIDFile   string
+	// Timeout bounds each command except transfers and commands that
+	// follow output; 0 means no limit.
+	Timeout time.Duration
+
+	// tab completion popup
+	Completions    []string
+	CompletionIdx  int
+	CompletionBase string
+
+	// reverse-i-search
+	Searching        bool
+	SearchQuery      string
+	SearchCandidates []string
+	SearchMatches    []string
+	SearchIdx        int
+
+	// Broadcast runs every command on all BroadcastPods at once; PodName is
+	// the first of them.
+	Broadcast     bool
+	BroadcastPods []string
 
 	// debug container support
+	DebugProfiles             []kubectl.DebugProfile
+	DebugProfile              string
 	UseDebugContainer         bool
 	DebugContainer            string
 	TargetRoot                string
 	OriginalPodSecurityPolicy string
 	ChangedPodSecurityPolicy  bool
+	// Journal records PodSecurity changes before they are applied; entries
+	// carry Kubeconfig so that they can be rolled back after a crash.
+	Journal    *journal.Journal
+	Kubeconfig string
 
 	// quit handling
 	Quitting bool
 }
 
-func InitialModel() *Model {
+func newDelegate(showDescription bool) list.DefaultDelegate {
 	delegate := list.NewDefaultDelegate()
-	delegate.ShowDescription = false
+	delegate.ShowDescription = showDescription
 	delegate.SetSpacing(0)
-	l := list.New([]list.Item{}, delegate, 0, 0)
-	l.Title = "Velg namespace"
+	return delegate
+}
+
+func InitialModel(backend kubectl.Backend) *Model {
+	l := list.New([]list.Item{}, newDelegate(false), 0, 0)
+	l.Title = "Velg kontekst"
 	l.SetShowHelp(false)
 	l.SetFilteringEnabled(true)
 
 	in := textinput.New()
-	in.Placeholder = "skriv kommando… (clear / ctrl+r / q)"
+	in.Placeholder = "skriv kommando… (clear / ctrl+r søk / ctrl+t / q)"
 	in.Focus()
 	in.CharLimit = 4096
 	in.Width = 60
@@ -79,14 +147,25 @@ func InitialModel() *Model {
 	sp := spinner.New()
 	sp.Spinner = spinner.Dot
 
+	store, _ := history.Open()
+	profiles, _ := kubectl.DebugProfiles("", nil)
+	j, _ := journal.Open()
+
 	return &Model{
-		Step:              types.StepPickNS,
+		Backend:           backend,
+		Step:              types.StepPickContext,
 		Lst:               l,
 		Input:             in,
 		Vp:                vp,
 		Spin:              sp,
-		TypeList:          []types.ResType{types.RtPod, types.RtDeployment, types.RtStatefulSet},
+		TypeList:          []types.ResType{types.RtPod, types.RtDeployment, types.RtStatefulSet, types.RtDaemonSet, types.RtJob, types.RtCronJob, types.RtReplicaSet},
 		HistIdx:           -1,
+		HistoryStore:      store,
+		DebugProfiles:     profiles,
+		DebugProfile:      kubectl.DefaultDebugProfile,
+		Journal:           j,
+		AutoPick:          true,
 		AutocompleteWords: make(map[string]bool),
+		Timeout:           config.DefaultExecTimeout,
 	}
 }
@@ -8,4 +8,6 @@ var (
 	HelpStyle   = lipgloss.NewStyle().Faint(true)
 	ErrStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
 	OkStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	WarnStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	SelStyle    = lipgloss.NewStyle().Reverse(true)
 )
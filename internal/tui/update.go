@@ -1,8 +1,11 @@
 package tui
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -24,9 +27,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.Height = msg.Height
 
 		if m.Step == types.StepShell {
-			m.Vp.Width = msg.Width - 2
-			m.Vp.Height = msg.Height - 3
-			m.Input.Width = msg.Width - 2
+			m.resizeShell()
 		} else {
 			m.Lst.SetSize(msg.Width-2, msg.Height-4)
 		}
@@ -41,6 +42,10 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		switch msg.Step {
+		case types.StepPickContext:
+			m.ContextList = msg.Values
+			m.SetList("Velg kontekst", msg.Values)
+			m.SelectValue(msg.Default)
 		case types.StepPickNS:
 			m.NsList = msg.Values
 			m.SetList("Velg namespace", msg.Values)
@@ -49,31 +54,137 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case types.StepPickOwnerOrPod:
 			if m.Rtype == types.RtPod {
 				m.PodList = msg.Values
-				m.SetList("Velg pod", msg.Values)
+				m.Pods = msg.Pods
+				m.showPods()
 			} else {
 				m.OwnerList = msg.Values
 				m.SetList("Velg workload", msg.Values)
 			}
 		case types.StepPickPodFromOwner:
 			m.PodList = msg.Values
-			m.SetList("Velg pod", msg.Values)
+			m.Pods = msg.Pods
+			m.showPods()
 		case types.StepPickContainer:
 			m.ContainerList = msg.Values
-			m.SetList("Velg container", msg.Values)
+			m.Containers = msg.Containers
+			m.showContainers()
+		}
+		if model, cmd, ok := m.autoPick(msg.Step, msg.Values); ok {
+			return model, cmd
+		}
+		return m, nil
+
+	case CmdOutputMsg:
+		text := msg.Text
+		if msg.Stderr {
+			text = ErrStyle.Render(text)
+		}
+		m.AppendOutput(text)
+		return m, waitForStream(msg.stream)
+
+	case CdMsg:
+		m.finish()
+		m.LastErr = ""
+		switch {
+		case msg.Cancelled:
+			m.AppendOutput(summary(msg.Cmd, msg.Took, WarnStyle.Render("CANCELLED")))
+			return m, nil
+		case msg.TimedOut:
+			m.LastErr = fmt.Sprintf("command timed out after %s (/timeout to change)", m.Timeout)
+			m.AppendOutput(summary(msg.Cmd, msg.Took, WarnStyle.Render("TIMEOUT")))
+			return m, nil
+		case msg.Err != nil:
+			m.LastErr = msg.Err.Error()
+			m.AppendOutput(ErrStyle.Render(msg.Err.Error()))
+			return m, nil
+		}
+		if msg.Dir != m.CurrentDir {
+			// An empty CurrentDir is the container's starting directory,
+			// which cd - can go back to as well.
+			m.PrevDir, m.HasPrevDir = m.CurrentDir, true
+			m.CurrentDir = msg.Dir
+			m.AutocompleteWords = make(map[string]bool)
+		}
+		m.AppendOutput(OkStyle.Render(fmt.Sprintf("Working directory: %s", m.CurrentDir)))
+		return m, nil
+
+	case TransferMsg:
+		if !msg.Done {
+			m.Transferred, m.TransferTotal = msg.Bytes, msg.Total
+			return m, waitForStream(msg.stream)
+		}
+		m.finish()
+		m.LastErr = ""
+		switch {
+		case msg.Cancelled:
+			m.AppendOutput(summary(msg.Cmd, msg.Took, WarnStyle.Render("CANCELLED")))
+		case msg.TimedOut:
+			m.LastErr = fmt.Sprintf("transfer timed out after %s (/timeout to change)", m.Timeout)
+			m.AppendOutput(summary(msg.Cmd, msg.Took, WarnStyle.Render("TIMEOUT")))
+		case msg.Err != nil:
+			m.LastErr = msg.Err.Error()
+			m.AppendOutput(ErrStyle.Render(msg.Err.Error()))
+			m.AppendOutput(summary(msg.Cmd, msg.Took, ErrStyle.Render("ERR")))
+		default:
+			m.AppendOutput(OkStyle.Render(fmt.Sprintf("✓ %s → %s  %s", msg.From, msg.To, formatBytes(msg.Bytes))))
+			m.AppendOutput(fmt.Sprintf("sha256 %s", msg.Sum))
+			m.AppendOutput(summary(msg.Cmd, msg.Took, OkStyle.Render("OK")))
+		}
+		return m, nil
+
+	case EditMsg:
+		return m.handleEditMsg(msg)
+
+	case BroadcastMsg:
+		if !msg.Done {
+			m.appendPodResult(msg.Result)
+			return m, waitForStream(msg.stream)
+		}
+		m.finish()
+		m.LastErr = ""
+		switch {
+		case msg.Cancelled:
+			m.AppendOutput(summary(msg.Cmd, msg.Took, WarnStyle.Render("CANCELLED")))
+		case msg.TimedOut:
+			m.LastErr = fmt.Sprintf("command timed out after %s (/timeout to change)", m.Timeout)
+			m.AppendOutput(summary(msg.Cmd, msg.Took, WarnStyle.Render("TIMEOUT")))
+		case msg.Diff:
+			m.appendDiff(msg)
+		default:
+			m.appendBroadcastSummary(msg)
 		}
 		return m, nil
 
 	case CmdResultMsg:
-		m.Loading = false
+		m.finish()
 		m.LastErr = ""
 
+		if msg.Cancelled {
+			m.AppendOutput(summary(msg.Cmd, msg.Took, WarnStyle.Render("CANCELLED")))
+			return m, nil
+		}
+		if msg.TimedOut {
+			m.LastErr = fmt.Sprintf("command timed out after %s (/timeout to change)", m.Timeout)
+			m.AppendOutput(summary(msg.Cmd, msg.Took, WarnStyle.Render("TIMEOUT")))
+			return m, nil
+		}
+
+		if msg.Err != nil && m.UseDebugContainer && containerGone(msg.Stderr) {
+			// The debug container's sleep ran out; it cannot be restarted.
+			m.AppendOutput(summary(msg.Cmd, msg.Took, ErrStyle.Render("ERR")))
+			m.AppendOutput(ErrStyle.Render(fmt.Sprintf("Debug container '%s' has exited. Creating a new one...", m.DebugContainer)))
+			m.UseDebugContainer = false
+			m.Loading = true
+			return m, tea.Batch(m.Spin.Tick, createDebugContainerCmd(m.Backend, m.Namespace, m.PodName, m.Container, m.debugProfile()))
+		}
+
 		if msg.Err != nil && !m.UseDebugContainer &&
 			(strings.Contains(msg.Stderr, "executable file not found") ||
 				strings.Contains(msg.Stderr, "OCI runtime exec failed") ||
 				strings.Contains(msg.Stderr, "not found")) {
 			m.AppendOutput(ErrStyle.Render("Container has no shell. Creating ephemeral debug container..."))
 
-			currentPolicy, err := kubectl.GetPodSecurityPolicy(m.Namespace)
+			currentPolicy, err := m.Backend.GetPodSecurityPolicy(m.Namespace)
 			if err != nil {
 				m.AppendOutput(ErrStyle.Render(fmt.Sprintf("Failed to get current policy: %v", err)))
 				return m, nil
@@ -83,7 +194,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.AppendOutput(fmt.Sprintf("Namespace policy is '%s', changing to 'privileged'...", currentPolicy))
 				m.OriginalPodSecurityPolicy = currentPolicy
 
-				if err := kubectl.SetPodSecurityPolicy(m.Namespace, "privileged"); err != nil {
+				if err := m.setPodSecurityPolicy(currentPolicy, "privileged"); err != nil {
 					m.AppendOutput(ErrStyle.Render(fmt.Sprintf("Failed to change policy: %v", err)))
 					m.AppendOutput("You may need permissions to modify namespace labels.")
 					return m, nil
@@ -96,7 +207,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 			m.Loading = true
-			return m, tea.Batch(m.Spin.Tick, createDebugContainerCmd(m.Namespace, m.PodName, m.Container))
+			return m, tea.Batch(m.Spin.Tick, createDebugContainerCmd(m.Backend, m.Namespace, m.PodName, m.Container, m.debugProfile()))
 		}
 
 		status := OkStyle.Render("OK")
@@ -104,13 +215,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			status = ErrStyle.Render("ERR")
 			m.LastErr = strings.TrimSpace(msg.Stderr)
 		}
-		m.AppendOutput(fmt.Sprintf("» %s  (%s)  [%s]", msg.Cmd, msg.Took.Round(time.Millisecond), status))
-		if strings.TrimSpace(msg.Stdout) != "" {
-			m.AppendOutput(msg.Stdout)
-		}
-		if strings.TrimSpace(msg.Stderr) != "" {
-			m.AppendOutput(ErrStyle.Render(msg.Stderr))
-		}
+		m.AppendOutput(summary(msg.Cmd, msg.Took, status))
 		return m, nil
 
 	case DebugContainerMsg:
@@ -125,14 +230,14 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.AppendOutput("")
 				m.AppendOutput("Attempting to temporarily change namespace policy to 'privileged'...")
 
-				currentPolicy, err := kubectl.GetPodSecurityPolicy(m.Namespace)
+				currentPolicy, err := m.Backend.GetPodSecurityPolicy(m.Namespace)
 				if err != nil {
 					m.AppendOutput(ErrStyle.Render(fmt.Sprintf("Failed to get current policy: %v", err)))
 					return m, nil
 				}
 				m.OriginalPodSecurityPolicy = currentPolicy
 
-				if err := kubectl.SetPodSecurityPolicy(m.Namespace, "privileged"); err != nil {
+				if err := m.setPodSecurityPolicy(currentPolicy, "privileged"); err != nil {
 					m.AppendOutput(ErrStyle.Render(fmt.Sprintf("Failed to change policy: %v", err)))
 					m.AppendOutput("You may need permissions to modify namespace labels.")
 					return m, nil
@@ -148,33 +253,40 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.AppendOutput("")
 				m.AppendOutput("Retrying debug container creation...")
 				m.Loading = true
-				return m, tea.Batch(m.Spin.Tick, createDebugContainerCmd(m.Namespace, m.PodName, m.Container))
+				return m, tea.Batch(m.Spin.Tick, createDebugContainerCmd(m.Backend, m.Namespace, m.PodName, m.Container, m.debugProfile()))
 			} else {
 				m.AppendOutput(ErrStyle.Render(fmt.Sprintf("Failed to create debug container: %v", msg.Err)))
 			}
 			return m, nil
 		}
 
+		// The container that ran out mid-session has already been reported.
+		if msg.Exited != "" && msg.Exited != m.DebugContainer {
+			m.AppendOutput(fmt.Sprintf("Debug container '%s' has exited and cannot be restarted.", msg.Exited))
+		}
 		m.UseDebugContainer = true
 		m.DebugContainer = msg.DebugContainer
 		m.TargetRoot = msg.TargetRoot
 		m.CurrentDir = "/"
-		m.AppendOutput(OkStyle.Render(fmt.Sprintf("Debug container '%s' created.", msg.DebugContainer)))
+		if msg.Reused {
+			m.AppendOutput(OkStyle.Render(fmt.Sprintf("Reusing debug container '%s'.", msg.DebugContainer)))
+		} else {
+			m.AppendOutput(OkStyle.Render(fmt.Sprintf("Debug container '%s' created.", msg.DebugContainer)))
+		}
 		m.AppendOutput(fmt.Sprintf("Target container filesystem: %s", msg.TargetRoot))
 		m.AppendOutput("")
 		m.AppendOutput("Waiting for debug container to be ready...")
 
 		// Wait for the debug container to be ready
-		if err := kubectl.WaitForDebugContainerReady(m.Namespace, m.PodName, msg.DebugContainer); err != nil {
+		if err := m.Backend.WaitForDebugContainerReady(m.Namespace, m.PodName, msg.DebugContainer); err != nil {
 			m.AppendOutput(ErrStyle.Render(fmt.Sprintf("Debug container failed to start: %v", err)))
 			return m, nil
 		}
 
 		m.AppendOutput("Testing filesystem access...")
 
-		testCmd := fmt.Sprintf("ls %s 2>&1 | head -5", msg.TargetRoot)
-		m.Loading = true
-		return m, tea.Batch(m.Spin.Tick, runCommand(m.Namespace, m.PodName, m.Container, testCmd, "", true, m.DebugContainer, m.TargetRoot))
+		testCmd := "ls 2>&1 | head -5"
+		return m, m.startCommand(testCmd)
 
 	case tea.KeyMsg:
 		return m.handleKeyPress(msg, &cmds)
@@ -192,6 +304,11 @@ func (m *Model) handleKeyPress(msg tea.KeyMsg, cmds *[]tea.Cmd) (tea.Model, tea.
 	k := msg.String()
 
 	if k == "ctrl+c" {
+		if m.Step == types.StepShell && m.CancelRun != nil {
+			m.CancelRun()
+			m.CancelRun = nil
+			return m, nil
+		}
 		return m, tea.Quit
 	}
 
@@ -207,7 +324,12 @@ func (m *Model) handleKeyPress(msg tea.KeyMsg, cmds *[]tea.Cmd) (tea.Model, tea.
 }
 
 func (m *Model) handleBackNavigation() (tea.Model, tea.Cmd) {
+	m.AutoPick = false
 	switch m.Step {
+	case types.StepPickNS:
+		m.Step = types.StepPickContext
+		m.Loading = true
+		return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickContext, m))
 	case types.StepPickType:
 		m.Step = types.StepPickNS
 		m.Loading = true
@@ -234,11 +356,22 @@ func (m *Model) handleBackNavigation() (tea.Model, tea.Cmd) {
 }
 
 func (m *Model) handleShellInput(k string, cmds *[]tea.Cmd) (tea.Model, tea.Cmd) {
+	if m.Searching {
+		return m.handleSearchInput(k, cmds)
+	}
+
+	if len(m.Completions) > 0 && m.handleCompletionKey(k) {
+		return m, nil
+	}
+
 	switch k {
 	case "ctrl+r":
-		m = InitialModel()
+		m.startSearch()
+		return m, nil
+	case "ctrl+t":
+		m = m.retarget()
 		m.Loading = true
-		return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickNS, m))
+		return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickContext, m))
 	case "tab":
 		return m.handleAutocomplete(), nil
 	case "up":
@@ -259,89 +392,145 @@ func (m *Model) handleShellInput(k string, cmds *[]tea.Cmd) (tea.Model, tea.Cmd)
 	return m, tea.Batch(*cmds...)
 }
 
+// handleSearchInput drives reverse-i-search: typing narrows the fuzzy
+// matches, ctrl+r steps to the next match, enter runs it, tab or right
+// accepts it for editing and esc or ctrl+g restores the original input.
+func (m *Model) handleSearchInput(k string, cmds *[]tea.Cmd) (tea.Model, tea.Cmd) {
+	switch k {
+	case "ctrl+r", "up":
+		if m.SearchIdx < len(m.SearchMatches)-1 {
+			m.SearchIdx++
+		}
+	case "down":
+		if m.SearchIdx > 0 {
+			m.SearchIdx--
+		}
+	case "backspace":
+		if r := []rune(m.SearchQuery); len(r) > 0 {
+			m.SearchQuery = string(r[:len(r)-1])
+			m.updateSearch()
+		}
+	case "esc", "ctrl+g":
+		m.Searching = false
+	case "enter":
+		m.Searching = false
+		if match := m.searchMatch(); match != "" {
+			m.Input.SetValue(match)
+			return m.handleCommand(cmds)
+		}
+	case "tab", "right":
+		m.Searching = false
+		if match := m.searchMatch(); match != "" {
+			m.Input.SetValue(match)
+			m.Input.CursorEnd()
+		}
+	default:
+		if r := []rune(k); len(r) == 1 {
+			m.SearchQuery += k
+			m.updateSearch()
+		}
+	}
+	return m, nil
+}
+
+// handleAutocomplete completes the last word from remote paths and words
+// seen in the output. The first Tab inserts the candidates' common prefix and
+// opens a popup when there is more than one; further Tabs cycle through it.
 func (m *Model) handleAutocomplete() tea.Model {
+	if len(m.Completions) > 0 {
+		m.cycleCompletion(1)
+		return m
+	}
+
 	currentInput := m.Input.Value()
 	words := strings.Fields(currentInput)
-	if len(words) == 0 {
+	if len(words) == 0 || strings.HasSuffix(currentInput, " ") {
 		return m
 	}
 
 	lastWord := words[len(words)-1]
-
-	var dirPath, partialFile string
-
-	if strings.Contains(lastWord, "/") {
-		lastSlash := strings.LastIndex(lastWord, "/")
-		dirPath = lastWord[:lastSlash+1]
-		partialFile = lastWord[lastSlash+1:]
-	} else {
-		dirPath = "./"
-		partialFile = lastWord
+	dirPath, partialFile := "", lastWord
+	if i := strings.LastIndex(lastWord, "/"); i >= 0 {
+		dirPath, partialFile = lastWord[:i+1], lastWord[i+1:]
 	}
 
-	listCmd := fmt.Sprintf(
-		`for f in %s%s*; do [ -e "$f" ] && echo "$f" && break; done 2>/dev/null`,
-		dirPath, partialFile,
-	)
-
-	var stdout string
-	var err error
-
-	if m.UseDebugContainer {
-		stdout, _, err = kubectl.ExecInDebugContainer(m.Namespace, m.PodName, m.DebugContainer, m.TargetRoot, listCmd, m.CurrentDir)
-	} else {
-		stdout, _, err = kubectl.ExecInPod(m.Namespace, m.PodName, m.Container, listCmd, m.CurrentDir)
+	seen := map[string]bool{}
+	var candidates []string
+	// Completion runs inside Update, so a hung exec must not block the UI
+	// for long.
+	timeout := completionTimeout
+	if m.Timeout > 0 && m.Timeout < timeout {
+		timeout = m.Timeout
 	}
-
-	if err == nil && stdout != "" {
-		firstMatch := strings.TrimSpace(stdout)
-		if strings.Contains(firstMatch, "/") {
-			firstMatch = firstMatch[strings.LastIndex(firstMatch, "/")+1:]
-		}
-
-		checkDirCmd := fmt.Sprintf(`[ -d "%s%s" ] && echo "DIR" || echo "FILE"`, dirPath, firstMatch)
-		var isDirOut string
-		if m.UseDebugContainer {
-			isDirOut, _, _ = kubectl.ExecInDebugContainer(m.Namespace, m.PodName, m.DebugContainer, m.TargetRoot, checkDirCmd, m.CurrentDir)
-		} else {
-			isDirOut, _, _ = kubectl.ExecInPod(m.Namespace, m.PodName, m.Container, checkDirCmd, m.CurrentDir)
-		}
-
-		isDirOut = strings.TrimSpace(isDirOut)
-
-		if isDirOut == "DIR" {
-			firstMatch = firstMatch + "/"
-		}
-
-		if dirPath == "./" {
-			words[len(words)-1] = firstMatch
-		} else {
-			words[len(words)-1] = dirPath + firstMatch
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	paths, _ := kubectl.Completions(ctx, m.Backend, m.execSpec(), dirPath, partialFile)
+	cancel()
+	for _, p := range paths {
+		if !seen[dirPath+p] {
+			seen[dirPath+p] = true
+			candidates = append(candidates, dirPath+p)
 		}
-
-		m.Input.SetValue(strings.Join(words, " "))
-		m.Input.CursorEnd()
-		return m
 	}
-
 	if len(lastWord) >= 2 {
-		var matches []string
+		var outputWords []string
 		for word := range m.AutocompleteWords {
-			if strings.HasPrefix(word, lastWord) && word != lastWord {
-				matches = append(matches, word)
+			if strings.HasPrefix(word, lastWord) && word != lastWord && !seen[word] {
+				seen[word] = true
+				outputWords = append(outputWords, word)
 			}
 		}
+		sort.Strings(outputWords)
+		candidates = append(candidates, outputWords...)
+	}
+	if len(candidates) == 0 {
+		return m
+	}
 
-		if len(matches) > 0 {
-			sort.Strings(matches)
-			words[len(words)-1] = matches[0]
-			m.Input.SetValue(strings.Join(words, " "))
-			m.Input.CursorEnd()
-		}
+	m.CompletionBase = strings.TrimSuffix(currentInput, lastWord)
+	if len(candidates) == 1 {
+		m.Input.SetValue(m.CompletionBase + candidates[0])
+		m.Input.CursorEnd()
+		return m
 	}
+
+	m.Input.SetValue(m.CompletionBase + commonPrefix(candidates))
+	m.Input.CursorEnd()
+	m.Completions = candidates
+	m.CompletionIdx = -1
+	m.resizeShell()
 	return m
 }
 
+// handleCompletionKey handles keys while the completion popup is open. It
+// reports false for keys the popup does not use, after closing it.
+func (m *Model) handleCompletionKey(k string) bool {
+	switch k {
+	case "tab", "down":
+		m.cycleCompletion(1)
+	case "shift+tab", "up":
+		m.cycleCompletion(-1)
+	case "enter", "esc":
+		m.closeCompletions()
+	default:
+		m.closeCompletions()
+		return false
+	}
+	return true
+}
+
+func (m *Model) cycleCompletion(step int) {
+	n := len(m.Completions)
+	m.CompletionIdx = ((m.CompletionIdx+step)%n + n) % n
+	m.Input.SetValue(m.CompletionBase + m.Completions[m.CompletionIdx])
+	m.Input.CursorEnd()
+}
+
+func (m *Model) closeCompletions() {
+	m.Completions = nil
+	m.CompletionIdx = -1
+	m.resizeShell()
+}
+
 func (m *Model) handleHistoryUp() tea.Model {
 	if len(m.History) == 0 {
 		return m
@@ -380,6 +569,12 @@ func (m *Model) handleCommand(cmds *[]tea.Cmd) (tea.Model, tea.Cmd) {
 	if cmdline == "" {
 		return m, nil
 	}
+	// One command at a time: a second one would take over ctrl+c and the
+	// pid file. The input is kept so it can be sent once this one is done.
+	if m.Running != "" {
+		m.LastErr = fmt.Sprintf("%s is still running (ctrl+c cancels it)", m.Running)
+		return m, nil
+	}
 	m.Input.SetValue("")
 	m.HistIdx = -1
 
@@ -398,19 +593,260 @@ func (m *Model) handleCommand(cmds *[]tea.Cmd) (tea.Model, tea.Cmd) {
 		return m.handleCopyCommand(cmdline), nil
 	}
 
+	if strings.HasPrefix(cmdline, "/timeout ") || cmdline == "/timeout" {
+		return m.handleTimeoutCommand(cmdline), nil
+	}
+
 	if strings.HasPrefix(cmdline, "cd ") || cmdline == "cd" {
-		return m.handleCdCommand(cmdline), nil
+		return m, m.handleCdCommand(cmdline)
+	}
+
+	if word, _, _ := strings.Cut(cmdline, " "); m.Broadcast && (word == "/get" || word == "/put" || word == "/edit") {
+		m.AppendOutput(ErrStyle.Render(fmt.Sprintf("%s is not available when broadcasting to all pods", word)))
+		return m, nil
+	}
+
+	if strings.HasPrefix(cmdline, "/diff ") || cmdline == "/diff" {
+		return m.handleDiffCommand(cmdline)
+	}
+
+	if strings.HasPrefix(cmdline, "/get ") || cmdline == "/get" {
+		return m.handleGetCommand(cmdline)
+	}
+
+	if strings.HasPrefix(cmdline, "/put ") || cmdline == "/put" {
+		return m.handlePutCommand(cmdline)
+	}
+
+	if strings.HasPrefix(cmdline, "/edit ") || cmdline == "/edit" {
+		return m.handleEditCommand(cmdline)
+	}
+
+	if strings.HasPrefix(cmdline, "/profile ") || cmdline == "/profile" {
+		return m.handleProfileCommand(cmdline), nil
 	}
 
-	if len(m.History) == 0 || m.History[len(m.History)-1] != cmdline {
-		m.History = append(m.History, cmdline)
+	if cmdline == "/env" {
+		return m.handleEnvList(), nil
 	}
 
-	m.Loading = true
-	*cmds = append(*cmds, m.Spin.Tick, runCommand(m.Namespace, m.PodName, m.Container, cmdline, m.CurrentDir, m.UseDebugContainer, m.DebugContainer, m.TargetRoot))
+	if vars, ok := kubectl.ParseEnvCommand(cmdline); ok {
+		return m.handleEnvCommand(cmdline, vars), nil
+	}
+
+	m.addHistory(cmdline)
+
+	*cmds = append(*cmds, m.startCommand(cmdline))
 	return m, tea.Batch(*cmds...)
 }
 
+// handleTimeoutCommand shows or sets the per-command timeout. "0" and "off"
+// disable it.
+func (m *Model) handleTimeoutCommand(cmdline string) tea.Model {
+	arg := strings.TrimSpace(strings.TrimPrefix(cmdline, "/timeout"))
+	switch arg {
+	case "":
+		if m.Timeout == 0 {
+			m.AppendOutput("Timeout: off")
+		} else {
+			m.AppendOutput(fmt.Sprintf("Timeout: %s", m.Timeout))
+		}
+		return m
+	case "off":
+		arg = "0"
+	}
+
+	d, err := time.ParseDuration(arg)
+	if err != nil || d < 0 {
+		m.AppendOutput(ErrStyle.Render(fmt.Sprintf("Invalid timeout %q (e.g. /timeout 30s, /timeout off)", arg)))
+		return m
+	}
+	m.Timeout = d
+	if d == 0 {
+		m.AppendOutput(OkStyle.Render("Timeout disabled"))
+	} else {
+		m.AppendOutput(OkStyle.Render(fmt.Sprintf("Timeout set to %s", d)))
+	}
+	return m
+}
+
+// handleDiffCommand runs a command on several pods or containers and diffs
+// the results: /diff <command>.
+func (m *Model) handleDiffCommand(cmdline string) (tea.Model, tea.Cmd) {
+	command := strings.TrimSpace(strings.TrimPrefix(cmdline, "/diff"))
+	if command == "" {
+		m.AppendOutput(ErrStyle.Render("Usage: /diff <command>"))
+		return m, nil
+	}
+	specs, err := m.diffSpecs()
+	if err != nil {
+		m.AppendOutput(ErrStyle.Render(err.Error()))
+		return m, nil
+	}
+
+	m.addHistory(cmdline)
+	ctx := m.begin(cmdline)
+	for i := range specs {
+		specs[i].PIDFile = m.PIDFile
+	}
+	return m, tea.Batch(m.Spin.Tick, runBroadcast(ctx, m.Backend, specs, command, true))
+}
+
+// handleGetCommand downloads a remote file or directory:
+// /get [-f] <remote> [local]. -f overwrites an existing local file.
+func (m *Model) handleGetCommand(cmdline string) (tea.Model, tea.Cmd) {
+	args := strings.Fields(strings.TrimPrefix(cmdline, "/get"))
+	force := len(args) > 0 && args[0] == "-f"
+	if force {
+		args = args[1:]
+	}
+	if len(args) < 1 || len(args) > 2 {
+		m.AppendOutput(ErrStyle.Render("Usage: /get [-f] <remote> [local]"))
+		return m, nil
+	}
+	local := ""
+	if len(args) == 2 {
+		local = localPath(args[1])
+	}
+
+	m.addHistory(cmdline)
+	ctx := m.begin(cmdline)
+	return m, tea.Batch(m.Spin.Tick, downloadCmd(ctx, m.Backend, m.execSpec(), cmdline, args[0], local, force))
+}
+
+// handlePutCommand uploads a local file or directory: /put <local> [remote].
+// The destination defaults to the current directory.
+func (m *Model) handlePutCommand(cmdline string) (tea.Model, tea.Cmd) {
+	args := strings.Fields(strings.TrimPrefix(cmdline, "/put"))
+	if len(args) < 1 || len(args) > 2 {
+		m.AppendOutput(ErrStyle.Render("Usage: /put <local> [remote]"))
+		return m, nil
+	}
+	remote := "."
+	if len(args) == 2 {
+		remote = args[1]
+	}
+
+	m.addHistory(cmdline)
+	ctx := m.begin(cmdline)
+	return m, tea.Batch(m.Spin.Tick, uploadCmd(ctx, m.Backend, m.execSpec(), cmdline, localPath(args[0]), remote))
+}
+
+// handleEditCommand fetches a remote file for editing: /edit <path>.
+func (m *Model) handleEditCommand(cmdline string) (tea.Model, tea.Cmd) {
+	args := strings.Fields(strings.TrimPrefix(cmdline, "/edit"))
+	if len(args) != 1 {
+		m.AppendOutput(ErrStyle.Render("Usage: /edit <path>"))
+		return m, nil
+	}
+
+	m.addHistory(cmdline)
+	ctx := m.begin(cmdline)
+	return m, tea.Batch(m.Spin.Tick, fetchForEdit(ctx, m.Backend, m.execSpec(), cmdline, args[0]))
+}
+
+// handleEditMsg opens the editor once the file is fetched and writes it back
+// when the editor exits.
+func (m *Model) handleEditMsg(msg EditMsg) (tea.Model, tea.Cmd) {
+	m.finish()
+	m.LastErr = ""
+	switch {
+	case msg.Err != nil:
+		status := ErrStyle.Render("ERR")
+		switch {
+		case msg.Cancelled:
+			status = WarnStyle.Render("CANCELLED")
+		case msg.TimedOut:
+			m.LastErr = fmt.Sprintf("command timed out after %s (/timeout to change)", m.Timeout)
+			status = WarnStyle.Render("TIMEOUT")
+		default:
+			m.LastErr = msg.Err.Error()
+			m.AppendOutput(ErrStyle.Render(msg.Err.Error()))
+		}
+		if msg.Saved {
+			m.AppendOutput(fmt.Sprintf("Your version is kept in %s", msg.Local))
+		} else if msg.Local != "" {
+			os.Remove(msg.Local)
+		}
+		m.AppendOutput(summary(msg.Cmd, time.Since(m.RunStart), status))
+	case !msg.Edited:
+		return m, openEditor(msg)
+	case !msg.Saved:
+		ctx := m.track(msg.Cmd)
+		return m, tea.Batch(m.Spin.Tick, saveEdit(ctx, m.Backend, m.execSpec(), msg))
+	case msg.Unchanged:
+		m.AppendOutput("No changes.")
+		m.AppendOutput(summary(msg.Cmd, time.Since(m.RunStart), OkStyle.Render("OK")))
+	case msg.Changed:
+		m.LastErr = fmt.Sprintf("%s changed in the container while it was being edited; not saved", msg.Remote)
+		m.AppendOutput(WarnStyle.Render(m.LastErr))
+		m.AppendOutput(fmt.Sprintf("Your version is kept in %s (/put %s %s to overwrite)", msg.Local, msg.Local, msg.Remote))
+		m.AppendOutput(summary(msg.Cmd, time.Since(m.RunStart), WarnStyle.Render("CHANGED")))
+	default:
+		m.AppendOutput(OkStyle.Render(fmt.Sprintf("✓ Saved %s", msg.Remote)))
+		m.AppendOutput(summary(msg.Cmd, time.Since(m.RunStart), OkStyle.Render("OK")))
+	}
+	return m, nil
+}
+
+// handleProfileCommand lists the debug profiles or picks the one used for
+// the next debug container: /profile [name].
+func (m *Model) handleProfileCommand(cmdline string) tea.Model {
+	name := strings.TrimSpace(strings.TrimPrefix(cmdline, "/profile"))
+	m.AppendOutput(fmt.Sprintf("» %s", cmdline))
+	if name == "" {
+		for _, p := range m.DebugProfiles {
+			marker := " "
+			if p.Name == m.DebugProfile {
+				marker = "*"
+			}
+			desc := p.Image
+			if p.Base != "" && p.Base != p.Name {
+				desc = fmt.Sprintf("%s (base %s)", p.Image, p.Base)
+			}
+			m.AppendOutput(fmt.Sprintf("%s %-12s %s", marker, p.Name, desc))
+		}
+		return m
+	}
+
+	if _, ok := kubectl.FindDebugProfile(m.DebugProfiles, name); !ok {
+		m.AppendOutput(ErrStyle.Render(fmt.Sprintf("Unknown debug profile %q", name)))
+		return m
+	}
+	m.DebugProfile = name
+	m.AppendOutput(OkStyle.Render(fmt.Sprintf("Debug profile set to '%s'", name)))
+	if m.UseDebugContainer {
+		m.AppendOutput("It applies to the next debug container; the current one keeps its profile.")
+	}
+	return m
+}
+
+// handleEnvCommand records exports and unsets on the client; they are
+// replayed in front of every following command.
+func (m *Model) handleEnvCommand(cmdline string, vars []kubectl.EnvVar) tea.Model {
+	for _, v := range vars {
+		m.Env = slices.DeleteFunc(m.Env, func(e kubectl.EnvVar) bool { return e.Name == v.Name })
+		m.Env = append(m.Env, v)
+	}
+
+	m.addHistory(cmdline)
+	m.AppendOutput(fmt.Sprintf("» %s", cmdline))
+	m.AppendOutput(OkStyle.Render(fmt.Sprintf("Environment: %d variable(s) applied to following commands", len(m.Env))))
+	return m
+}
+
+func (m *Model) handleEnvList() tea.Model {
+	m.AppendOutput("» /env")
+	if len(m.Env) == 0 {
+		m.AppendOutput("No variables exported or unset in this session.")
+		return m
+	}
+	for _, v := range m.Env {
+		m.AppendOutput(v.String())
+	}
+	return m
+}
+
 func (m *Model) handleCopyCommand(cmdline string) tea.Model {
 	rangeStr := strings.TrimSpace(strings.TrimPrefix(cmdline, "/copy"))
 	var startLine, endLine int
@@ -457,33 +893,34 @@ func (m *Model) handleCopyCommand(cmdline string) tea.Model {
 	return m
 }
 
-func (m *Model) handleCdCommand(cmdline string) tea.Model {
-	newDir := strings.TrimSpace(strings.TrimPrefix(cmdline, "cd"))
-	if newDir == "" || newDir == "~" {
-		m.CurrentDir = ""
-	} else if strings.HasPrefix(newDir, "/") {
-		m.CurrentDir = newDir
-	} else {
-		if m.CurrentDir == "" {
-			m.CurrentDir = newDir
-		} else {
-			m.CurrentDir = m.CurrentDir + "/" + newDir
-		}
+// handleCdCommand checks the new directory in the container before
+// switching to it; the result arrives as a CdMsg. "cd -" returns to the
+// previous directory.
+func (m *Model) handleCdCommand(cmdline string) tea.Cmd {
+	arg := strings.TrimSpace(strings.TrimPrefix(cmdline, "cd"))
+	specs := []kubectl.ExecSpec{m.execSpec()}
+	if m.Broadcast {
+		specs = m.podSpecs()
 	}
 
-	m.AutocompleteWords = make(map[string]bool)
+	m.addHistory(cmdline)
 
-	if len(m.History) == 0 || m.History[len(m.History)-1] != cmdline {
-		m.History = append(m.History, cmdline)
-	}
-
-	dirDisplay := m.CurrentDir
-	if dirDisplay == "" {
-		dirDisplay = "~"
+	if arg == "-" {
+		if !m.HasPrevDir {
+			m.AppendOutput(fmt.Sprintf("» %s", cmdline))
+			m.LastErr = "cd: OLDPWD not set"
+			m.AppendOutput(ErrStyle.Render(m.LastErr))
+			return nil
+		}
+		// Start from the previous directory, which the exec maps onto the
+		// target's root like any other working directory.
+		for i := range specs {
+			specs[i].CurrentDir = m.PrevDir
+		}
+		arg = "."
 	}
-	m.AppendOutput(fmt.Sprintf("» %s", cmdline))
-	m.AppendOutput(OkStyle.Render(fmt.Sprintf("Working directory: %s", dirDisplay)))
-	return m
+	ctx := m.begin(cmdline)
+	return tea.Batch(m.Spin.Tick, changeDirCmd(ctx, m.Backend, specs, cmdline, arg))
 }
 
 func (m *Model) handleSelection(k string, cmds *[]tea.Cmd) (tea.Model, tea.Cmd) {
@@ -496,59 +933,147 @@ func (m *Model) handleSelection(k string, cmds *[]tea.Cmd) (tea.Model, tea.Cmd)
 		if !ok {
 			return m, nil
 		}
-		val := chosen.Title()
+		m.AutoPick = true
+		return m.choose(chosen.Title())
+	case "ctrl+g":
+		if m.Step == types.StepPickPodFromOwner && m.Rtype == types.RtDeployment {
+			m.GroupByRevision = !m.GroupByRevision
+			m.showPods()
+			return m, nil
+		}
+	}
 
-		switch m.Step {
-		case types.StepPickNS:
-			m.Namespace = val
-			m.Step = types.StepPickType
-			m.Loading = true
-			return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickType, m))
+	var cmd tea.Cmd
+	m.Lst, cmd = m.Lst.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
+	*cmds = append(*cmds, cmd)
+	return m, tea.Batch(*cmds...)
+}
 
-		case types.StepPickType:
-			m.Rtype = types.ResType(val)
-			m.Step = types.StepPickOwnerOrPod
-			m.Loading = true
-			return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickOwnerOrPod, m))
+// choose records val as the selection for the current step and moves the
+// wizard forward.
+func (m *Model) choose(val string) (tea.Model, tea.Cmd) {
+	switch m.Step {
+	case types.StepPickContext:
+		if err := m.Backend.UseContext(val); err != nil {
+			m.LastErr = err.Error()
+			return m, nil
+		}
+		m.Context = val
+		m.Step = types.StepPickNS
+		m.Loading = true
+		return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickNS, m))
 
-		case types.StepPickOwnerOrPod:
-			if m.Rtype == types.RtPod {
-				m.PodName = val
-				m.Step = types.StepPickContainer
-				m.Loading = true
-				return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickContainer, m))
-			}
-			m.OwnerName = val
-			m.Step = types.StepPickPodFromOwner
-			m.Loading = true
-			return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickPodFromOwner, m))
+	case types.StepPickNS:
+		m.Namespace = val
+		m.Step = types.StepPickType
+		m.Loading = true
+		return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickType, m))
 
-		case types.StepPickPodFromOwner:
+	case types.StepPickType:
+		m.Rtype = types.ResType(val)
+		m.Step = types.StepPickOwnerOrPod
+		m.Loading = true
+		return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickOwnerOrPod, m))
+
+	case types.StepPickOwnerOrPod:
+		if m.Rtype == types.RtPod {
 			m.PodName = val
 			m.Step = types.StepPickContainer
 			m.Loading = true
 			return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickContainer, m))
+		}
+		m.OwnerName = val
+		m.Step = types.StepPickPodFromOwner
+		m.Loading = true
+		return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickPodFromOwner, m))
 
-		case types.StepPickContainer:
-			m.Container = val
-			m.Step = types.StepShell
-			m.Loading = false
-			m.Output.Reset()
-			m.Vp.SetContent("")
-			m.Input.Focus()
-
-			if m.Width > 0 && m.Height > 0 {
-				m.Vp.Width = m.Width - 2
-				m.Vp.Height = m.Height - 3
-				m.Input.Width = m.Width - 2
+	case types.StepPickPodFromOwner:
+		m.Broadcast = val == allPodsChoice
+		m.BroadcastPods = nil
+		if m.Broadcast {
+			for _, p := range m.Pods {
+				if p.Status == "Running" {
+					m.BroadcastPods = append(m.BroadcastPods, p.Name)
+				}
+			}
+			if len(m.BroadcastPods) == 0 {
+				m.Broadcast = false
+				m.LastErr = "ingen pods kjører"
+				return m, nil
 			}
+			val = m.BroadcastPods[0]
+		}
+		m.PodName = val
+		m.Step = types.StepPickContainer
+		m.Loading = true
+		return m, tea.Batch(m.Spin.Tick, loadStep(types.StepPickContainer, m))
 
-			return m, nil
+	case types.StepPickContainer:
+		for _, c := range m.Containers {
+			if c.Name == val && !c.Running {
+				m.LastErr = fmt.Sprintf("container %q kjører ikke (%s)", val, c.State)
+				return m, nil
+			}
+		}
+		m.Container = val
+		m.Step = types.StepShell
+		m.Loading = false
+		m.loadHistory()
+		m.Output.Reset()
+		m.Vp.SetContent("")
+		m.Input.Focus()
+
+		if m.Width > 0 && m.Height > 0 {
+			m.resizeShell()
 		}
+
+		return m, nil
 	}
+	return m, nil
+}
 
-	var cmd tea.Cmd
-	m.Lst, cmd = m.Lst.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
-	*cmds = append(*cmds, cmd)
-	return m, tea.Batch(*cmds...)
+// autoPick chooses an item on behalf of the user when the value was given on
+// the command line, or when a pod or container step has a single candidate.
+// It returns false when the list should be shown instead.
+func (m *Model) autoPick(step types.Step, values []string) (tea.Model, tea.Cmd, bool) {
+	if !m.AutoPick {
+		return m, nil, false
+	}
+
+	var want string
+	switch step {
+	case types.StepPickOwnerOrPod:
+		if m.Rtype == types.RtPod {
+			want = m.PodName
+		} else {
+			want = m.OwnerName
+		}
+	case types.StepPickPodFromOwner:
+		want = m.PodName
+	case types.StepPickContainer:
+		want = m.Container
+	}
+
+	if want != "" {
+		if slices.Contains(values, want) {
+			model, cmd := m.choose(want)
+			return model, cmd, true
+		}
+		m.LastErr = fmt.Sprintf("fant ikke %q", want)
+		return m, nil, false
+	}
+
+	if step == types.StepPickContainer {
+		values = nil
+		for _, c := range m.Containers {
+			if c.Running {
+				values = append(values, c.Name)
+			}
+		}
+	}
+	if (step == types.StepPickPodFromOwner || step == types.StepPickContainer) && len(values) == 1 {
+		model, cmd := m.choose(values[0])
+		return model, cmd, true
+	}
+	return m, nil, false
 }
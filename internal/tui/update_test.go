@@ -0,0 +1,283 @@
+package tui
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"kui/internal/kubectl"
+	"kui/internal/types"
+)
+
+// drive runs cmd the way the Bubble Tea runtime would and feeds the
+// resulting messages back into Update. Spinner ticks are dropped.
+func drive(m *Model, cmd tea.Cmd) *Model {
+	if cmd == nil {
+		return m
+	}
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		for _, c := range msg {
+			m = drive(m, c)
+		}
+	case LoadMsg, CmdOutputMsg, CmdResultMsg, CdMsg, TransferMsg:
+		next, cmd := m.Update(msg)
+		m = drive(next.(*Model), cmd)
+	}
+	return m
+}
+
+// pick selects val in the current list and presses enter.
+func pick(t *testing.T, m *Model, val string) *Model {
+	t.Helper()
+	m.SelectValue(val)
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = drive(next.(*Model), cmd)
+	if m.LastErr != "" {
+		t.Fatalf("pick %q: %s", val, m.LastErr)
+	}
+	return m
+}
+
+func TestWizardToShell(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	fake := &fakeBackend{
+		Contexts:   []string{"dev", "prod"},
+		Current:    "prod",
+		Namespaces: []string{"default", "shop"},
+		Workloads:  map[types.ResType][]string{types.RtDeployment: {"api", "web"}},
+		Pods: []types.PodInfo{
+			{Name: "api-1", Status: "Running"},
+			{Name: "api-2", Status: "Running"},
+		},
+		Containers: []types.ContainerInfo{
+			{Name: "app", Kind: types.ContainerRegular, State: "running", Running: true},
+			{Name: "init", Kind: types.ContainerInit, State: "terminated"},
+		},
+		Output: "hello\n",
+	}
+
+	m := InitialModel(fake)
+	next, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	m = drive(next.(*Model), m.Init())
+
+	steps := []struct {
+		step types.Step
+		val  string
+	}{
+		{types.StepPickContext, "dev"},
+		{types.StepPickNS, "shop"},
+		{types.StepPickType, string(types.RtDeployment)},
+		{types.StepPickOwnerOrPod, "api"},
+		// The only running container is picked automatically.
+		{types.StepPickPodFromOwner, "api-2"},
+	}
+	for _, s := range steps {
+		if m.Step != s.step {
+			t.Fatalf("step = %v, want %v", m.Step, s.step)
+		}
+		m = pick(t, m, s.val)
+	}
+
+	if m.Step != types.StepShell {
+		t.Fatalf("step = %v, want shell", m.Step)
+	}
+	if fake.UsedContext != "dev" || m.Namespace != "shop" || m.OwnerName != "api" || m.PodName != "api-2" || m.Container != "app" {
+		t.Fatalf("target = %s/%s/%s/%s/%s", fake.UsedContext, m.Namespace, m.OwnerName, m.PodName, m.Container)
+	}
+
+	m.Input.SetValue("echo hello")
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = drive(next.(*Model), cmd)
+	if len(fake.Commands) != 1 || !strings.Contains(fake.Commands[0], "echo hello") {
+		t.Fatalf("commands = %q", fake.Commands)
+	}
+	if !strings.Contains(m.Output.String(), "hello") {
+		t.Fatalf("output = %q", m.Output.String())
+	}
+}
+
+// shell returns a model with the shell open on fake.
+func shell(t *testing.T, fake *fakeBackend) *Model {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	m := InitialModel(fake)
+	m.Namespace, m.PodName, m.Container = "shop", "api-1", "app"
+	m.Step = types.StepShell
+	return m
+}
+
+// run types cmdline into the shell and waits for it to finish.
+func run(m *Model, cmdline string) *Model {
+	m.Input.SetValue(cmdline)
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	return drive(next.(*Model), cmd)
+}
+
+func TestCdBackInProcRoot(t *testing.T) {
+	fake := &fakeBackend{Output: "/proc/1/root/app\n"}
+	m := shell(t, fake)
+	m.UseDebugContainer = true
+	m.DebugContainer = "kcmd-debug-1"
+	m.TargetRoot = "/proc/1/root"
+	m.CurrentDir = "/"
+
+	m = run(m, "cd -")
+	if m.LastErr != "cd: OLDPWD not set" || len(fake.Commands) != 0 {
+		t.Fatalf("cd - without OLDPWD: err %q, commands %q", m.LastErr, fake.Commands)
+	}
+
+	m.PrevDir, m.HasPrevDir = "/app", true
+	m = run(m, "cd -")
+	if m.CurrentDir != "/app" || m.PrevDir != "/" {
+		t.Fatalf("dir = %q, prev = %q", m.CurrentDir, m.PrevDir)
+	}
+	if len(fake.Specs) != 1 || fake.Specs[0].CurrentDir != "/app" || fake.Specs[0].TargetRoot != "/proc/1/root" {
+		t.Fatalf("specs = %+v", fake.Specs)
+	}
+}
+
+func TestCdBackToStartingDir(t *testing.T) {
+	fake := &fakeBackend{Handler: func(spec kubectl.ExecSpec, cmdline string, stdout io.Writer) error {
+		dir := "/srv/app"
+		if strings.Contains(cmdline, "cd /tmp") {
+			dir = "/tmp"
+		}
+		_, err := io.WriteString(stdout, dir+"\n")
+		return err
+	}}
+	m := shell(t, fake)
+
+	// cd runs like any other command, so ctrl+c cancels it.
+	m.Input.SetValue("cd /tmp")
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(*Model)
+	if m.Running != "cd /tmp" || m.CancelRun == nil {
+		t.Fatalf("running = %q", m.Running)
+	}
+	m = drive(m, cmd)
+	if m.CurrentDir != "/tmp" || m.Running != "" {
+		t.Fatalf("dir = %q, running = %q", m.CurrentDir, m.Running)
+	}
+
+	m = run(m, "cd -")
+	if m.LastErr != "" || m.CurrentDir != "/srv/app" || m.PrevDir != "/tmp" {
+		t.Fatalf("err = %q, dir = %q, prev = %q", m.LastErr, m.CurrentDir, m.PrevDir)
+	}
+	if last := fake.Specs[len(fake.Specs)-1]; last.CurrentDir != "" {
+		t.Fatalf("cd - started from %q, want the starting directory", last.CurrentDir)
+	}
+}
+
+func TestGetKeepsExistingFile(t *testing.T) {
+	content, fail := "", false
+	fake := &fakeBackend{Handler: func(_ kubectl.ExecSpec, cmdline string, stdout io.Writer) error {
+		if !strings.HasPrefix(cmdline, "cat ") && !strings.Contains(cmdline, " cat ") {
+			_, err := io.WriteString(stdout, "file\n5\n")
+			return err
+		}
+		io.WriteString(stdout, content)
+		if fail {
+			return errors.New("connection reset")
+		}
+		return nil
+	}}
+	m := shell(t, fake)
+	local := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(local, []byte("mine\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	check := func(want string) {
+		t.Helper()
+		data, err := os.ReadFile(local)
+		if err != nil || string(data) != want {
+			t.Fatalf("local file = %q, %v; want %q", data, err, want)
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(local)); len(entries) != 1 {
+			t.Fatalf("left behind: %v", entries)
+		}
+	}
+
+	m = run(m, "/get /etc/config.yaml "+local)
+	if !strings.Contains(m.LastErr, "already exists") {
+		t.Fatalf("err = %q", m.LastErr)
+	}
+	check("mine\n")
+
+	content, fail = "par", true
+	m = run(m, "/get -f /etc/config.yaml "+local)
+	if !strings.Contains(m.LastErr, "connection reset") {
+		t.Fatalf("err = %q", m.LastErr)
+	}
+	check("mine\n")
+
+	content, fail = "hello", false
+	m = run(m, "/get -f /etc/config.yaml "+local)
+	if m.LastErr != "" {
+		t.Fatalf("err = %q", m.LastErr)
+	}
+	check("hello")
+}
+
+func TestBroadcastCdChecksEveryPod(t *testing.T) {
+	fake := &fakeBackend{Handler: func(spec kubectl.ExecSpec, cmdline string, stdout io.Writer) error {
+		if spec.Pod == "api-2" {
+			return errors.New("sh: cd: can't cd to /data")
+		}
+		_, err := io.WriteString(stdout, "/data\n")
+		return err
+	}}
+	m := shell(t, fake)
+	m.Broadcast = true
+	m.BroadcastPods = []string{"api-1", "api-2", "api-3"}
+	m.CurrentDir = "/"
+
+	m = run(m, "cd /data")
+	if m.CurrentDir != "/" || !strings.Contains(m.LastErr, "1/3 pods: api-2") {
+		t.Fatalf("dir = %q, err = %q", m.CurrentDir, m.LastErr)
+	}
+
+	m = run(m, "/getx")
+	if strings.Contains(m.Output.String(), "not available when broadcasting") {
+		t.Fatal("/getx was taken for /get")
+	}
+}
+
+func TestOneCommandAtATime(t *testing.T) {
+	fake := &fakeBackend{Output: "ok\n"}
+	m := shell(t, fake)
+
+	m.Input.SetValue("tail -f /var/log/app.log")
+	next, first := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(*Model)
+	pidFile := m.PIDFile
+
+	m.Input.SetValue("ls")
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(*Model)
+	if cmd != nil || m.Input.Value() != "ls" || !strings.Contains(m.LastErr, "still running") {
+		t.Fatalf("second command: input %q, err %q", m.Input.Value(), m.LastErr)
+	}
+
+	// ctrl+c still belongs to the first command.
+	next, cmd = m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	m = next.(*Model)
+	if cmd != nil || m.CancelRun != nil {
+		t.Fatal("ctrl+c did not cancel the running command")
+	}
+	m = drive(m, first)
+	if m.Running != "" || !strings.Contains(m.Output.String(), "CANCELLED") {
+		t.Fatalf("running = %q, output = %q", m.Running, m.Output.String())
+	}
+
+	m = run(m, "ls")
+	last := fake.Specs[len(fake.Specs)-1]
+	if last.PIDFile == "" || last.PIDFile == pidFile {
+		t.Fatalf("pid file %q reused from %q", last.PIDFile, pidFile)
+	}
+}
@@ -3,6 +3,7 @@ package tui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"kui/internal/types"
 )
@@ -18,12 +19,27 @@ func (m Model) View() string {
 
 	if m.Step == types.StepShell {
 		loading := ""
-		if m.Loading {
+		if m.Running != "" {
+			progress := ""
+			if m.TransferTotal > 0 {
+				progress = fmt.Sprintf(" %s / %s (%d%%)", formatBytes(m.Transferred), formatBytes(m.TransferTotal), min(m.Transferred*100/m.TransferTotal, 100))
+			} else if m.Transferred > 0 {
+				progress = " " + formatBytes(m.Transferred)
+			}
+			loading = fmt.Sprintf(" %s kjører %s… %s%s  (ctrl+c avbryter)", m.Spin.View(), m.Running, time.Since(m.RunStart).Round(100*time.Millisecond), progress)
+		} else if m.Loading {
 			loading = " " + m.Spin.View() + " kjører…"
 		}
 
 		body := BorderStyle.Render(m.Vp.View())
-		foot := BorderStyle.Render(m.Input.View() + loading)
+		input := m.Input.View()
+		if m.Searching {
+			input = m.searchView()
+		}
+		foot := BorderStyle.Render(input + loading)
+		if popup := m.completionView(); popup != "" {
+			foot += "\n" + BorderStyle.Render(popup)
+		}
 
 		parts := []string{
 			head,
@@ -48,17 +64,23 @@ func (m Model) View() string {
 }
 
 func (m Model) header() string {
-	target := fmt.Sprintf("ns=%s type=%s pod=%s container=%s", m.Namespace, m.Rtype, m.PodName, m.Container)
+	pod := m.PodName
+	if m.Broadcast && m.Step == types.StepShell {
+		pod = fmt.Sprintf("alle (%d)", len(m.BroadcastPods))
+	}
+	target := fmt.Sprintf("ctx=%s ns=%s type=%s pod=%s container=%s", m.Context, m.Namespace, m.Rtype, pod, m.Container)
 	switch m.Step {
+	case types.StepPickContext:
+		return TitleStyle.Render("KCMD — Velg kontekst")
 	case types.StepPickNS:
-		return TitleStyle.Render("KCMD — Velg namespace")
+		return TitleStyle.Render("KCMD — Velg namespace") + "  " + HelpStyle.Render(fmt.Sprintf("ctx=%s", m.Context))
 	case types.StepPickType:
 		return TitleStyle.Render("KCMD — Velg type")
 	case types.StepPickOwnerOrPod:
 		if m.Rtype == types.RtPod {
 			return TitleStyle.Render("KCMD — Velg pod") + "  " + HelpStyle.Render(target)
 		}
-		return TitleStyle.Render("KCMD — Velg workload (deployment/statefulset)") + "  " + HelpStyle.Render(target)
+		return TitleStyle.Render(fmt.Sprintf("KCMD — Velg workload (%s)", m.Rtype)) + "  " + HelpStyle.Render(target)
 	case types.StepPickPodFromOwner:
 		return TitleStyle.Render("KCMD — Velg pod fra workload") + "  " + HelpStyle.Render(target)
 	case types.StepPickContainer:
@@ -72,9 +94,47 @@ func (m Model) header() string {
 
 func (m Model) help() string {
 	switch m.Step {
+	case types.StepPickPodFromOwner:
+		if m.Rtype == types.RtDeployment {
+			return HelpStyle.Render("enter=velg  / = filter  ctrl+g=grupper etter revisjon  esc=tilbake  ctrl+c=quit")
+		}
+		return HelpStyle.Render("enter=velg  / = filter  esc=tilbake  ctrl+c=quit")
 	case types.StepShell:
-		return HelpStyle.Render("enter=kjør  tab=autocomplete  ↑/↓=historikk  pgup/pgdn=scroll  /copy 1,10=copy  /quit=exit  ctrl+r=retarget")
+		return HelpStyle.Render("enter=kjør  tab=autocomplete  ↑/↓=historikk  pgup/pgdn=scroll  /copy 1,10=copy  /quit=exit  ctrl+r=søk  ctrl+t=retarget")
 	default:
 		return HelpStyle.Render("enter=velg  / = filter  esc=tilbake  ctrl+c=quit")
 	}
 }
+
+func (m Model) searchView() string {
+	label := "(reverse-i-search)"
+	if len(m.SearchMatches) == 0 {
+		label = "(failed reverse-i-search)"
+	}
+	line := fmt.Sprintf("%s`%s': %s", label, m.SearchQuery, m.searchMatch())
+	if len(m.SearchMatches) > 1 {
+		line += HelpStyle.Render(fmt.Sprintf("  [%d/%d]", m.SearchIdx+1, len(m.SearchMatches)))
+	}
+	return line
+}
+
+// completionView renders the visible window of the completion popup.
+func (m Model) completionView() string {
+	n := m.popupLines()
+	if n == 0 {
+		return ""
+	}
+	start := 0
+	if m.CompletionIdx >= n {
+		start = m.CompletionIdx - n + 1
+	}
+	lines := make([]string, 0, n)
+	for i := start; i < start+n; i++ {
+		if i == m.CompletionIdx {
+			lines = append(lines, SelStyle.Render(m.Completions[i]))
+		} else {
+			lines = append(lines, HelpStyle.Render(m.Completions[i]))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,9 +1,15 @@
 package types
 
+import (
+	"strings"
+	"time"
+)
+
 type Step int
 
 const (
-	StepPickNS Step = iota
+	StepPickContext Step = iota
+	StepPickNS
 	StepPickType
 	StepPickOwnerOrPod
 	StepPickPodFromOwner
@@ -17,8 +23,71 @@ const (
 	RtPod         ResType = "pod"
 	RtDeployment  ResType = "deployment"
 	RtStatefulSet ResType = "statefulset"
+	RtDaemonSet   ResType = "daemonset"
+	RtJob         ResType = "job"
+	RtCronJob     ResType = "cronjob"
+	RtReplicaSet  ResType = "replicaset"
+)
+
+// ParseResType resolves a kind as typed on the command line, accepting the
+// same short names and plurals as kubectl.
+func ParseResType(s string) (ResType, bool) {
+	switch strings.ToLower(s) {
+	case "po", "pod", "pods":
+		return RtPod, true
+	case "deploy", "deployment", "deployments":
+		return RtDeployment, true
+	case "sts", "statefulset", "statefulsets":
+		return RtStatefulSet, true
+	case "ds", "daemonset", "daemonsets":
+		return RtDaemonSet, true
+	case "job", "jobs":
+		return RtJob, true
+	case "cj", "cronjob", "cronjobs":
+		return RtCronJob, true
+	case "rs", "replicaset", "replicasets":
+		return RtReplicaSet, true
+	}
+	return "", false
+}
+
+// PodInfo describes a pod in the pod picker. ReplicaSet and Revision are
+// only set for pods that belong to a Deployment.
+type PodInfo struct {
+	Name       string
+	Status     string
+	Ready      int
+	Total      int
+	Restarts   int
+	Node       string
+	Created    time.Time
+	ReplicaSet string
+	Revision   int
+}
+
+// Healthy reports whether the pod is running with every container ready.
+func (p PodInfo) Healthy() bool {
+	return p.Status == "Running" && p.Ready == p.Total
+}
+
+type ContainerKind string
+
+const (
+	ContainerRegular   ContainerKind = "container"
+	ContainerSidecar   ContainerKind = "sidecar"
+	ContainerInit      ContainerKind = "init"
+	ContainerEphemeral ContainerKind = "ephemeral"
 )
 
+// ContainerInfo describes a container in the container picker. Only running
+// containers can be exec'd into.
+type ContainerInfo struct {
+	Name    string
+	Kind    ContainerKind
+	State   string
+	Running bool
+}
+
 type ListItem struct {
 	title string
 	desc  string
@@ -0,0 +1,22 @@
+// Package xdg locates kcmd's per-user state directory.
+package xdg
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// StateDir returns $XDG_STATE_HOME/kcmd, or ~/.local/state/kcmd when the
+// variable is unset. It fails only when no home directory can be found; the
+// directory itself is not created.
+func StateDir() (string, error) {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(base, "kcmd"), nil
+}
@@ -1,47 +1,181 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"kui/internal/config"
+	"kui/internal/journal"
 	"kui/internal/kubectl"
 	"kui/internal/tui"
+	"kui/internal/types"
 )
 
 func main() {
-	if _, err := exec.LookPath("kubectl"); err != nil {
-		fmt.Fprintln(os.Stderr, "Fant ikke kubectl i PATH.")
-		os.Exit(1)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kcmd [flags] [TYPE/NAME | POD]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Examples:")
+		fmt.Fprintln(os.Stderr, "  kcmd -n payments deploy/api -c app")
+		fmt.Fprintln(os.Stderr, "  kcmd -n payments api-7d9f8-x2x1q")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+
+	// A broken config file must not stand in the way of --help, so the
+	// error is only reported once the flags have been parsed.
+	cfg, cfgErr := config.Load()
+	if cfgErr != nil {
+		cfg = &config.Config{}
+	}
+
+	backendName := flag.String("backend", "native", "cluster backend: native (client-go) or kubectl")
+	kubeconfig := flag.String("kubeconfig", "", "path to the kubeconfig file (default: $KUBECONFIG or ~/.kube/config)")
+	kubeContext := flag.String("context", "", "kube context to use; skips the context step")
+	var namespace, container string
+	flag.StringVar(&namespace, "n", "", "namespace (shorthand)")
+	flag.StringVar(&namespace, "namespace", "", "namespace; skips the context and namespace steps")
+	flag.StringVar(&container, "c", "", "container (shorthand)")
+	flag.StringVar(&container, "container", "", "container to open the shell in")
+	timeout := flag.Duration("timeout", cfg.Timeout(), "per-command exec timeout; 0 disables it")
+	defaultProfile := cfg.DebugProfile
+	if defaultProfile == "" {
+		defaultProfile = kubectl.DefaultDebugProfile
+	}
+	debugProfile := flag.String("debug-profile", defaultProfile, "debug container profile: default, general, baseline, restricted, netadmin, sysadmin or one from the config file")
+	flag.Parse()
+	if cfgErr != nil {
+		fmt.Fprintf(os.Stderr, "Kunne ikke lese config: %v\n", cfgErr)
+		os.Exit(2)
+	}
+
+	// flag stops at the first positional argument; keep parsing so that
+	// "deploy/api -c app" works as well as "-c app deploy/api".
+	var positional []string
+	for args := flag.Args(); len(args) > 0; args = flag.Args() {
+		positional = append(positional, args[0])
+		if err := flag.CommandLine.Parse(args[1:]); err != nil {
+			os.Exit(2)
+		}
+	}
+	if len(positional) > 1 {
+		fmt.Fprintf(os.Stderr, "Forventet ett mål, fikk %d: %s\n", len(positional), strings.Join(positional, " "))
+		os.Exit(2)
 	}
 
-	p := tea.NewProgram(tui.InitialModel(), tea.WithAltScreen())
-	finalModel, err := p.Run()
+	var rtype types.ResType
+	var target string
+	var err error
+	if len(positional) == 1 {
+		rtype, target, err = parseTarget(positional[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	profiles, err := cfg.Profiles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Kunne ikke lese debug-profiler: %v\n", err)
+		os.Exit(2)
+	}
+	if _, ok := kubectl.FindDebugProfile(profiles, *debugProfile); !ok {
+		fmt.Fprintf(os.Stderr, "Ukjent debug-profil %q.\n", *debugProfile)
+		os.Exit(2)
+	}
+
+	backend, err := newBackend(*backendName, *kubeconfig, *kubeContext)
+	if errors.Is(err, kubectl.ErrNoCurrentContext) {
+		if namespace != "" {
+			fmt.Fprintln(os.Stderr, "Kubeconfig har ingen current-context; bruk --context.")
+			os.Exit(2)
+		}
+		// The context is picked in the wizard.
+		backend, err = kubectl.NewNativeUnbound(*kubeconfig), nil
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
-	if m, ok := finalModel.(*tui.Model); ok {
-		if m.ChangedPodSecurityPolicy {
-			if m.OriginalPodSecurityPolicy == "" {
-				fmt.Println("Removing PodSecurity policy label...")
-			} else {
-				fmt.Printf("Restoring namespace policy to '%s'...\n", m.OriginalPodSecurityPolicy)
-			}
+	// Skipping the context step needs a context to work in. Its name is
+	// resolved here since it keys the command history.
+	contextName := *kubeContext
+	if namespace != "" && contextName == "" {
+		_, current, err := backend.GetContexts()
+		if err == nil && current == "" {
+			fmt.Fprintln(os.Stderr, "Kubeconfig har ingen current-context; bruk --context.")
+			os.Exit(2)
+		}
+		contextName = current
+	}
 
-			if err := kubectl.SetPodSecurityPolicy(m.Namespace, m.OriginalPodSecurityPolicy); err != nil {
-				fmt.Printf("Failed to restore policy: %v\n", err)
-			} else {
-				fmt.Println("✓ Policy restored successfully")
-			}
+	j, err := journal.Open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Kunne ikke åpne PodSecurity-journal: %v\n", err)
+	}
+	offerRollback(*backendName, j)
 
-			time.Sleep(2 * time.Second)
-		}
+	model := tui.InitialModel(backend)
+	model.Context = contextName
+	model.Namespace = namespace
+	model.Rtype = rtype
+	if rtype == types.RtPod {
+		model.PodName = target
+	} else {
+		model.OwnerName = target
+	}
+	model.Container = container
+	model.Timeout = *timeout
+	model.DebugProfiles = profiles
+	model.DebugProfile = *debugProfile
+	model.Journal = j
+	model.Kubeconfig = *kubeconfig
+
+	// Bubble Tea's own handler only quits the program, and not at all while
+	// the editor runs; a hangup would leave the namespace privileged.
+	// Ctrl+C reaches the program as a key in raw mode, so only SIGTERM and
+	// SIGHUP are caught. The restore runs once, whichever path gets there.
+	p := tea.NewProgram(model, tea.WithAltScreen(), tea.WithoutSignalHandler())
+	var restoreOnce sync.Once
+	restored := false
+	restore := func() {
+		restoreOnce.Do(func() { restored = restoreOwn(*backendName, j) })
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-sigs
+		_ = p.ReleaseTerminal()
+		fmt.Fprintf(os.Stderr, "\nReceived %s.\n", sig)
+		restore()
+		os.Exit(1)
+	}()
+
+	finalModel, runErr := p.Run()
+	signal.Stop(sigs)
+	if runErr != nil {
+		fmt.Fprintln(os.Stderr, runErr)
+	}
+	restore()
+	if restored {
+		time.Sleep(2 * time.Second)
+	}
+	if runErr != nil {
+		os.Exit(1)
+	}
+
+	if m, ok := finalModel.(*tui.Model); ok {
 
 		if m.DebugContainer != "" {
 			fmt.Printf("\nEphemeral container '%s' was created in pod '%s'.\n", m.DebugContainer, m.PodName)
@@ -52,10 +186,8 @@ func main() {
 			fmt.Scanln(&response)
 			if strings.ToLower(strings.TrimSpace(response)) == "y" {
 				fmt.Printf("Deleting pod '%s'...\n", m.PodName)
-				args := []string{"delete", "pod", m.PodName, "-n", m.Namespace}
-				_, stderr, err := kubectl.Run(args...)
-				if err != nil {
-					fmt.Printf("Failed to delete pod: %v (stderr: %s)\n", err, string(stderr))
+				if err := backend.DeletePod(m.Namespace, m.PodName); err != nil {
+					fmt.Printf("Failed to delete pod: %v\n", err)
 				} else {
 					fmt.Println("✓ Pod deleted successfully. It will be recreated by the controller.")
 				}
@@ -63,3 +195,133 @@ func main() {
 		}
 	}
 }
+
+func newBackend(name, kubeconfig, kubeContext string) (kubectl.Backend, error) {
+	switch name {
+	case "native":
+		return kubectl.NewNative(kubeconfig, kubeContext)
+	case "kubectl":
+		if _, err := exec.LookPath("kubectl"); err != nil {
+			return nil, errors.New("Fant ikke kubectl i PATH.")
+		}
+		return kubectl.NewCLI(kubeconfig, kubeContext), nil
+	default:
+		return nil, fmt.Errorf("Ukjent backend %q (native eller kubectl).", name)
+	}
+}
+
+// offerRollback asks to roll back the changes left in the journal by earlier
+// runs that did not get to restore them.
+func offerRollback(backendName string, j *journal.Journal) {
+	entries, err := j.Pending()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Kunne ikke lese PodSecurity-journal: %v\n", err)
+		return
+	}
+	var stale []journal.Entry
+	for _, e := range entries {
+		if !running(e.PID) {
+			stale = append(stale, e)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	fmt.Println("PodSecurity changes from earlier runs were never restored:")
+	for _, e := range stale {
+		fmt.Printf("  %s  ctx=%s ns=%s  %s → '%s'\n", e.Time.Format("2006-01-02 15:04"), e.Context, e.Namespace, policyName(e.Original), e.Applied)
+	}
+	fmt.Print("Roll them back now? [y/N]: ")
+
+	var response string
+	fmt.Scanln(&response)
+	if strings.ToLower(strings.TrimSpace(response)) != "y" {
+		fmt.Println("Left as is; you will be asked again next time.")
+		return
+	}
+	rollback(backendName, j, stale)
+}
+
+// restoreOwn rolls back the changes made by this process and reports whether
+// there were any.
+func restoreOwn(backendName string, j *journal.Journal) bool {
+	entries, err := j.Own()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Kunne ikke lese PodSecurity-journal: %v\n", err)
+		return false
+	}
+	rollback(backendName, j, entries)
+	return len(entries) > 0
+}
+
+// rollback restores the labels recorded in entries, newest first. A label
+// that no longer has the value kcmd set is left alone.
+func rollback(backendName string, j *journal.Journal, entries []journal.Entry) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		backend, err := newBackend(backendName, e.Kubeconfig, e.Context)
+		if err != nil {
+			fmt.Printf("Failed to restore policy in %s/%s: %v\n", e.Context, e.Namespace, err)
+			continue
+		}
+		current, err := backend.GetPodSecurityPolicy(e.Namespace)
+		if err != nil {
+			fmt.Printf("Failed to restore policy in %s/%s: %v\n", e.Context, e.Namespace, err)
+			continue
+		}
+		if current != e.Applied {
+			fmt.Printf("Namespace '%s' policy is now %s, not '%s'; leaving it.\n", e.Namespace, policyName(current), e.Applied)
+			_ = j.Done(e.ID)
+			continue
+		}
+
+		if e.Original == "" {
+			fmt.Printf("Removing PodSecurity policy label from namespace '%s'...\n", e.Namespace)
+		} else {
+			fmt.Printf("Restoring namespace '%s' policy to '%s'...\n", e.Namespace, e.Original)
+		}
+		if err := backend.SetPodSecurityPolicy(e.Namespace, e.Original); err != nil {
+			fmt.Printf("Failed to restore policy: %v\n", err)
+			continue
+		}
+		_ = j.Done(e.ID)
+		fmt.Println("✓ Policy restored successfully")
+	}
+}
+
+func policyName(policy string) string {
+	if policy == "" {
+		return "no policy"
+	}
+	return fmt.Sprintf("'%s'", policy)
+}
+
+// running reports whether a process with pid exists, so that changes owned
+// by another kcmd that is still running are not rolled back under it.
+func running(pid int) bool {
+	if pid == os.Getpid() {
+		return false
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return proc.Signal(syscall.Signal(0)) == nil
+}
+
+// parseTarget splits a TYPE/NAME argument. A bare name is taken to be a pod.
+func parseTarget(arg string) (types.ResType, string, error) {
+	kind, name, ok := strings.Cut(arg, "/")
+	if !ok {
+		return types.RtPod, arg, nil
+	}
+	rtype, known := types.ParseResType(kind)
+	if !known {
+		return "", "", fmt.Errorf("ukjent ressurstype %q", kind)
+	}
+	if name == "" {
+		return "", "", fmt.Errorf("mangler navn i %q", arg)
+	}
+	return rtype, name, nil
+}